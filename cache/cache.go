@@ -0,0 +1,112 @@
+// Package cache provides imageprompt.Prompter decorator that caches responses.
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+
+	"github.com/vearutop/image-prompt/imageprompt"
+)
+
+// Store keeps cached entries, values are JSON documents.
+type Store interface {
+	// Get returns cached value, found is false if there is no valid entry.
+	Get(ctx context.Context, key string) (value []byte, found bool, err error)
+	// Set stores value.
+	Set(ctx context.Context, key string, value []byte) error
+}
+
+// Key returns cache key of a request, it is a hex SHA-256 of image hash, prompt, model and options.
+func Key(jpegImage []byte, prompt, model string, opts imageprompt.Options) string {
+	img := sha256.Sum256(jpegImage)
+	o, _ := json.Marshal(opts) //nolint:errchkjson // Options are always serializable.
+
+	h := sha256.New()
+	h.Write(img[:])
+
+	for _, s := range []string{prompt, model, string(o)} {
+		h.Write([]byte{0})
+		h.Write([]byte(s))
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Prompter serves responses of upstream prompter from cache.
+//
+// Options from imageprompt.WithOptions are a part of cache key.
+type Prompter struct {
+	// OnError is called with cache store errors, they do not fail requests.
+	OnError func(err error)
+
+	upstream imageprompt.Prompter
+	store    Store
+}
+
+var _ imageprompt.ResponsePrompter = &Prompter{}
+
+// New creates caching prompter.
+func New(upstream imageprompt.Prompter, store Store) *Prompter {
+	return &Prompter{upstream: upstream, store: store}
+}
+
+// ModelName returns the name of upstream LLM.
+func (p *Prompter) ModelName() string {
+	return p.upstream.ModelName()
+}
+
+// PromptImage asks LLM about JPEG image, or returns cached answer.
+func (p *Prompter) PromptImage(ctx context.Context, prompt string, jpegImage io.Reader) (string, error) {
+	res, err := p.PromptImageResponse(ctx, prompt, jpegImage)
+
+	return res.Text, err
+}
+
+// PromptImageResponse asks LLM about JPEG image, or returns cached response with Cached flag.
+func (p *Prompter) PromptImageResponse(ctx context.Context, prompt string, jpegImage io.Reader) (imageprompt.Response, error) {
+	img, err := io.ReadAll(jpegImage)
+	if err != nil {
+		return imageprompt.Response{}, err
+	}
+
+	key := Key(img, prompt, p.upstream.ModelName(), imageprompt.OptionsFromContext(ctx))
+
+	data, found, err := p.store.Get(ctx, key)
+	p.reportError(err)
+
+	if found {
+		var res imageprompt.Response
+
+		if err := json.Unmarshal(data, &res); err == nil {
+			res.Cached = true
+
+			return res, nil
+		}
+
+		p.reportError(err)
+	}
+
+	res, err := imageprompt.PromptImageResponse(ctx, p.upstream, prompt, bytes.NewReader(img))
+	if err != nil {
+		return res, err
+	}
+
+	data, err = json.Marshal(res)
+	if err == nil {
+		err = p.store.Set(ctx, key, data)
+	}
+
+	p.reportError(err)
+
+	return res, nil
+}
+
+func (p *Prompter) reportError(err error) {
+	if err != nil && p.OnError != nil {
+		p.OnError(imageprompt.RedactError(err))
+	}
+}
@@ -0,0 +1,91 @@
+package cache_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/vearutop/image-prompt/cache"
+	"github.com/vearutop/image-prompt/imageprompt"
+)
+
+func TestKey(t *testing.T) {
+	img := []byte("jpeg")
+	base := cache.Key(img, "caption", "model", imageprompt.Options{})
+
+	for _, tc := range []struct {
+		name  string
+		key   string
+		equal bool
+	}{
+		{name: "same request", key: cache.Key([]byte("jpeg"), "caption", "model", imageprompt.Options{}), equal: true},
+		{name: "other image", key: cache.Key([]byte("png"), "caption", "model", imageprompt.Options{})},
+		{name: "other prompt", key: cache.Key(img, "describe", "model", imageprompt.Options{})},
+		{name: "other model", key: cache.Key(img, "caption", "other", imageprompt.Options{})},
+		{name: "alternatives", key: cache.Key(img, "caption", "model", imageprompt.Options{N: 3})},
+		{name: "logprobs", key: cache.Key(img, "caption", "model", imageprompt.Options{Logprobs: true})},
+		{name: "shifted separator", key: cache.Key(img, "caption\x00model", "", imageprompt.Options{})},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if (tc.key == base) != tc.equal {
+				t.Fatalf("equal %v expected", tc.equal)
+			}
+		})
+	}
+
+	// Key is stable for equal options.
+	o := imageprompt.Options{N: 2, Confidence: true}
+	if cache.Key(img, "caption", "model", o) != cache.Key(img, "caption", "model", o) {
+		t.Fatal("stable key expected")
+	}
+}
+
+type countingPrompter struct {
+	calls int
+}
+
+func (c *countingPrompter) PromptImage(_ context.Context, _ string, _ io.Reader) (string, error) {
+	c.calls++
+
+	return "caption", nil
+}
+
+func (c *countingPrompter) ModelName() string {
+	return "counting"
+}
+
+func TestPrompter_PromptImageResponse(t *testing.T) {
+	store, err := cache.NewFS(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upstream := &countingPrompter{}
+	p := cache.New(upstream, store)
+
+	for _, tc := range []struct {
+		name   string
+		ctx    context.Context //nolint:containedctx
+		img    string
+		cached bool
+		calls  int
+	}{
+		{name: "miss", ctx: context.Background(), img: "a", calls: 1},
+		{name: "hit", ctx: context.Background(), img: "a", cached: true, calls: 1},
+		{name: "other image", ctx: context.Background(), img: "b", calls: 2},
+		{name: "other options", ctx: imageprompt.WithOptions(context.Background(), imageprompt.Options{Confidence: true}), img: "a", calls: 3},
+		{name: "hit with options", ctx: imageprompt.WithOptions(context.Background(), imageprompt.Options{Confidence: true}), img: "a", cached: true, calls: 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := p.PromptImageResponse(tc.ctx, "caption", bytes.NewReader([]byte(tc.img)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if res.Text != "caption" || res.Cached != tc.cached || upstream.calls != tc.calls {
+				t.Fatalf("cached %v with %d calls expected, %v with %d received", tc.cached, tc.calls, res.Cached, upstream.calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FS is a filesystem Store with TTL and size limit.
+//
+// Entries are stored as JSON files, oldest entries are removed when size limit is exceeded.
+type FS struct {
+	dir     string
+	ttl     time.Duration
+	maxSize int64
+
+	mu      sync.Mutex
+	size    int64 // Total size of entries, -1 if unknown.
+	evicted time.Time
+}
+
+var _ Store = &FS{}
+
+// NewFS creates filesystem store in a directory.
+//
+// Zero ttl keeps entries forever, zero maxSize (in bytes) disables size limit.
+func NewFS(dir string, ttl time.Duration, maxSize int64) (*FS, error) {
+	if dir == "" {
+		return nil, errors.New("cache directory is empty")
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	return &FS{dir: dir, ttl: ttl, maxSize: maxSize, size: -1}, nil
+}
+
+func (f *FS) path(key string) string {
+	return filepath.Join(f.dir, key[:min(2, len(key))], key+".json")
+}
+
+// Get returns cached value if it is not expired.
+func (f *FS) Get(_ context.Context, key string) ([]byte, bool, error) {
+	fn := f.path(key)
+
+	st, err := os.Stat(fn)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, false, nil
+		}
+
+		return nil, false, err
+	}
+
+	if f.expired(st.ModTime(), time.Now()) {
+		return nil, false, nil
+	}
+
+	data, err := os.ReadFile(fn) //nolint:gosec // File name is built from a hash.
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, false, nil
+		}
+
+		return nil, false, err
+	}
+
+	return data, true, nil
+}
+
+func (f *FS) expired(mod, now time.Time) bool {
+	return f.ttl > 0 && now.Sub(mod) > f.ttl
+}
+
+// Set stores value and removes oldest entries if size limit is exceeded.
+func (f *FS) Set(_ context.Context, key string, data []byte) error {
+	fn := f.path(key)
+
+	if err := os.MkdirAll(filepath.Dir(fn), 0o700); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var prev int64
+	if st, err := os.Stat(fn); err == nil {
+		prev = st.Size()
+	}
+
+	if err := writeFile(fn, data); err != nil {
+		return err
+	}
+
+	if f.size >= 0 {
+		f.size += int64(len(data)) - prev
+	}
+
+	now := time.Now()
+
+	if f.maxSize > 0 && (f.size < 0 || f.size > f.maxSize) {
+		return f.evict(now)
+	}
+
+	// Expired entries are removed periodically, even without size limit.
+	if f.ttl > 0 && now.Sub(f.evicted) > f.ttl {
+		return f.evict(now)
+	}
+
+	return nil
+}
+
+// writeFile replaces file atomically, a unique temporary file allows concurrent writers.
+func writeFile(fn string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(fn), filepath.Base(fn)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), fn)
+	}
+
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+
+	return err
+}
+
+type entry struct {
+	path string
+	size int64
+	mod  time.Time
+}
+
+// evict removes expired entries and oldest entries over size limit, f.mu must be locked.
+func (f *FS) evict(now time.Time) error {
+	var (
+		entries []entry
+		total   int64
+	)
+
+	err := filepath.WalkDir(f.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || !strings.HasSuffix(path, ".json") {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+
+			return err
+		}
+
+		if f.expired(info.ModTime(), now) {
+			return os.Remove(path)
+		}
+
+		entries = append(entries, entry{path: path, size: info.Size(), mod: info.ModTime()})
+		total += info.Size()
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	slices.SortFunc(entries, func(a, b entry) int {
+		return a.mod.Compare(b.mod)
+	})
+
+	for _, e := range entries {
+		if f.maxSize <= 0 || total <= f.maxSize {
+			break
+		}
+
+		if err := os.Remove(e.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		total -= e.size
+	}
+
+	f.size = total
+	f.evicted = now
+
+	return nil
+}
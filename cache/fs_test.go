@@ -0,0 +1,206 @@
+package cache
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFS_Get_ttl(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		ttl   time.Duration
+		age   time.Duration
+		found bool
+	}{
+		{name: "fresh", ttl: time.Hour, age: time.Minute, found: true},
+		{name: "expired", ttl: time.Hour, age: 2 * time.Hour, found: false},
+		{name: "no ttl", ttl: 0, age: 1000 * time.Hour, found: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := NewFS(t.TempDir(), tc.ttl, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := context.Background()
+
+			if err := f.Set(ctx, "abc", []byte(`"v"`)); err != nil {
+				t.Fatal(err)
+			}
+
+			mod := time.Now().Add(-tc.age)
+			if err := os.Chtimes(f.path("abc"), mod, mod); err != nil {
+				t.Fatal(err)
+			}
+
+			v, found, err := f.Get(ctx, "abc")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if found != tc.found || (found && string(v) != `"v"`) {
+				t.Fatalf("found %v expected, %v %s received", tc.found, found, v)
+			}
+		})
+	}
+}
+
+func TestFS_Set_evict(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		ttl     time.Duration
+		maxSize int64
+		ages    []time.Duration // Ages of existing entries k0, k1, ...
+		kept    []string        // Entries kept after setting "new".
+	}{
+		{
+			name:    "oldest over size",
+			maxSize: 30,
+			ages:    []time.Duration{3 * time.Minute, time.Minute, 2 * time.Minute},
+			kept:    []string{"k1", "new"},
+		},
+		{
+			name:    "under size",
+			maxSize: 100,
+			ages:    []time.Duration{3 * time.Minute, time.Minute},
+			kept:    []string{"k0", "k1", "new"},
+		},
+		{
+			name: "expired without size limit",
+			ttl:  time.Hour,
+			ages: []time.Duration{2 * time.Hour, time.Minute},
+			kept: []string{"k1", "new"},
+		},
+		{
+			name:    "expired and oldest",
+			ttl:     time.Hour,
+			maxSize: 25,
+			ages:    []time.Duration{2 * time.Hour, 3 * time.Minute, time.Minute},
+			kept:    []string{"k2", "new"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := NewFS(t.TempDir(), tc.ttl, tc.maxSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := context.Background()
+			value := []byte(`"0123456789"`) // 12 bytes.
+
+			for i, age := range tc.ages {
+				k := "k" + strconv.Itoa(i)
+				if err := f.Set(ctx, k, value); err != nil {
+					t.Fatal(err)
+				}
+
+				mod := time.Now().Add(-age)
+				if err := os.Chtimes(f.path(k), mod, mod); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// Forcing periodic cleanup of expired entries.
+			f.evicted = time.Time{}
+
+			if err := f.Set(ctx, "new", value); err != nil {
+				t.Fatal(err)
+			}
+
+			var kept []string
+
+			err = filepath.WalkDir(f.dir, func(path string, d fs.DirEntry, err error) error {
+				if err == nil && !d.IsDir() {
+					kept = append(kept, strings.TrimSuffix(filepath.Base(path), ".json"))
+				}
+
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if strings.Join(kept, ",") != strings.Join(tc.kept, ",") {
+				t.Fatalf("%v expected, %v kept", tc.kept, kept)
+			}
+		})
+	}
+}
+
+func TestFS_Set_overwrite(t *testing.T) {
+	f, err := NewFS(t.TempDir(), 0, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	// Overwriting an entry does not count its size twice, so nothing is evicted.
+	for _, k := range []string{"a", "b", "a", "a", "a"} {
+		if err := f.Set(ctx, k, []byte(`"0123456789"`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, k := range []string{"a", "b"} {
+		if _, found, err := f.Get(ctx, k); err != nil || !found {
+			t.Fatalf("%s: entry expected, %v", k, err)
+		}
+	}
+
+	if f.size != 24 {
+		t.Fatalf("size 24 expected, %d received", f.size)
+	}
+}
+
+func TestFS_Set_concurrent(t *testing.T) {
+	dir := t.TempDir()
+
+	f, err := NewFS(dir, time.Hour, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		ctx = context.Background()
+		wg  sync.WaitGroup
+	)
+
+	for i := range 50 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			// Same and different keys.
+			for _, k := range []string{"shared", "k" + strconv.Itoa(i)} {
+				if err := f.Set(ctx, k, []byte(strconv.Itoa(i))); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	v, found, err := f.Get(ctx, "shared")
+	if err != nil || !found {
+		t.Fatalf("entry expected, %v", err)
+	}
+
+	if n, err := strconv.Atoi(string(v)); err != nil || n < 0 || n >= 50 {
+		t.Fatalf("unexpected value %q", v)
+	}
+
+	tmp, err := filepath.Glob(filepath.Join(dir, "*", "*.tmp"))
+	if err != nil || len(tmp) > 0 {
+		t.Fatalf("temporary files left: %v %v", tmp, err)
+	}
+}
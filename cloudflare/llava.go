@@ -9,6 +9,7 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/vearutop/image-prompt/imageprompt"
@@ -49,20 +50,60 @@ func (ip *ImagePrompter) ModelName() string {
 }
 
 // PromptImage asks LLM about JPEG image.
+//
+// Returned errors are redacted with imageprompt.RedactError.
 func (ip *ImagePrompter) PromptImage(ctx context.Context, prompt string, jpegImage io.Reader) (string, error) {
+	res, err := ip.PromptImageResponse(ctx, prompt, jpegImage)
+
+	return res.Text, err
+}
+
+// PromptImageResponse asks LLM about JPEG image and returns detailed response.
+//
+// Returned errors are redacted with imageprompt.RedactError.
+func (ip *ImagePrompter) PromptImageResponse(ctx context.Context, prompt string, jpegImage io.Reader) (imageprompt.Response, error) {
+	imageprompt.RegisterSecret(ip.AuthKey)
+
+	res, err := ip.promptImage(ctx, prompt, jpegImage)
+
+	return res, imageprompt.RedactError(err)
+}
+
+func (ip *ImagePrompter) promptImage(ctx context.Context, prompt string, jpegImage io.Reader) (imageprompt.Response, error) {
+	n := imageprompt.OptionsFromContext(ctx).N
+	if n <= 1 {
+		return ip.generate(ctx, prompt, jpegImage, 0)
+	}
+
+	img, err := io.ReadAll(jpegImage)
+	if err != nil {
+		return imageprompt.Response{}, err
+	}
+
+	// Worker has no native alternatives, they are generated with different seeds.
+	return imageprompt.PromptAlternatives(n, func(seed int) (imageprompt.Response, error) {
+		return ip.generate(ctx, prompt, bytes.NewReader(img), seed)
+	})
+}
+
+func (ip *ImagePrompter) generate(ctx context.Context, prompt string, jpegImage io.Reader, seed int) (imageprompt.Response, error) {
 	baseURL := ip.BaseURL
 	if baseURL == "" {
-		return "", errors.New("baseURL is empty")
+		return imageprompt.Response{}, errors.New("baseURL is empty")
 	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL, jpegImage)
 	if err != nil {
-		return "", err
+		return imageprompt.Response{}, err
 	}
 
 	req.Header.Set("Authorization", ip.AuthKey)
 	req.Header.Set("Prompt", prompt)
 
+	if seed != 0 {
+		req.Header.Set("Seed", strconv.Itoa(seed))
+	}
+
 	tr := ip.Transport
 	if tr == nil {
 		tr = http.DefaultTransport
@@ -70,18 +111,22 @@ func (ip *ImagePrompter) PromptImage(ctx context.Context, prompt string, jpegIma
 
 	resp, err := tr.RoundTrip(req)
 	if err != nil {
-		return "", err
+		return imageprompt.Response{}, err
 	}
 
 	defer resp.Body.Close() //nolint:errcheck
 
 	cont, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", err
+		return imageprompt.Response{}, err
 	}
 
 	if resp.StatusCode == http.StatusServiceUnavailable && bytes.Contains(cont, []byte("Worker exceeded resource limits")) {
-		return "", imageprompt.ErrResourceExhausted
+		return imageprompt.Response{}, imageprompt.ErrResourceExhausted
+	}
+
+	if err := imageprompt.CheckStatus(resp, cont); err != nil {
+		return imageprompt.Response{}, err
 	}
 
 	type Resp struct {
@@ -91,8 +136,10 @@ func (ip *ImagePrompter) PromptImage(ctx context.Context, prompt string, jpegIma
 	re := Resp{}
 
 	if err := json.Unmarshal(cont, &re); err != nil {
-		return "", err
+		return imageprompt.Response{}, err
 	}
 
-	return strings.Trim(re.Description, `" \t`), nil
+	return imageprompt.Response{
+		Text: strings.Trim(re.Description, `" \t`),
+	}, nil
 }
@@ -14,6 +14,8 @@ export default {
                 prompt = "Generate a detailed caption for this image"
             }
 
+            const seed = parseInt(request.headers.get("seed") || "0")
+
             const file = await request.arrayBuffer();
             const image = [...new Uint8Array(file)]
 
@@ -21,11 +23,16 @@ export default {
             var now;
 
             now = new Date();
-            response = await env.AI.run(model, {
+            var params = {
                 image: image,
                 prompt: prompt,
                 max_tokens: 512,
-            });
+            }
+            if (seed) {
+                params.seed = seed
+            }
+
+            response = await env.AI.run(model, params);
             response.elapsedTimeMs = new Date() - now;
             response.prompt = prompt;
             response.model = model
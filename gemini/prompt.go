@@ -75,7 +75,13 @@ type Response struct {
 				EndIndex   int `json:"endIndex"`
 			} `json:"citationSources"`
 		} `json:"citationMetadata"`
-		AvgLogprobs float64 `json:"avgLogprobs"`
+		AvgLogprobs    float64 `json:"avgLogprobs"`
+		LogprobsResult struct {
+			ChosenCandidates []struct {
+				Token          string  `json:"token"`
+				LogProbability float64 `json:"logProbability"`
+			} `json:"chosenCandidates"`
+		} `json:"logprobsResult"`
 	} `json:"candidates"`
 	UsageMetadata struct {
 		PromptTokenCount     int `json:"promptTokenCount"`
@@ -99,10 +105,29 @@ func (ip *ImagePrompter) ModelName() string {
 }
 
 // PromptImage asks LLM about JPEG image.
+//
+// Returned errors are redacted with imageprompt.RedactError.
 func (ip *ImagePrompter) PromptImage(ctx context.Context, prompt string, jpegImage io.Reader) (string, error) {
+	res, err := ip.PromptImageResponse(ctx, prompt, jpegImage)
+
+	return res.Text, err
+}
+
+// PromptImageResponse asks LLM about JPEG image and returns detailed response.
+//
+// Returned errors are redacted with imageprompt.RedactError.
+func (ip *ImagePrompter) PromptImageResponse(ctx context.Context, prompt string, jpegImage io.Reader) (imageprompt.Response, error) {
+	imageprompt.RegisterSecret(ip.AuthKey)
+
+	res, err := ip.promptImage(ctx, prompt, jpegImage)
+
+	return res, imageprompt.RedactError(err)
+}
+
+func (ip *ImagePrompter) promptImage(ctx context.Context, prompt string, jpegImage io.Reader) (imageprompt.Response, error) {
 	img, err := io.ReadAll(jpegImage)
 	if err != nil {
-		return "", err
+		return imageprompt.Response{}, err
 	}
 
 	type InlineData struct {
@@ -119,8 +144,14 @@ func (ip *ImagePrompter) PromptImage(ctx context.Context, prompt string, jpegIma
 		Parts []Part `json:"parts"`
 	}
 
+	type GenerationConfig struct {
+		CandidateCount   int  `json:"candidateCount,omitempty"`
+		ResponseLogprobs bool `json:"responseLogprobs,omitempty"`
+	}
+
 	type Req struct {
-		Contents []Content `json:"contents"`
+		Contents         []Content         `json:"contents"`
+		GenerationConfig *GenerationConfig `json:"generationConfig,omitempty"`
 	}
 
 	req := Req{}
@@ -133,22 +164,34 @@ func (ip *ImagePrompter) PromptImage(ctx context.Context, prompt string, jpegIma
 		},
 	}
 
+	// Confidence is calculated from avgLogprobs that are reported by default.
+	opts := imageprompt.OptionsFromContext(ctx)
+
+	if opts.N > 1 || opts.Logprobs {
+		req.GenerationConfig = &GenerationConfig{ResponseLogprobs: opts.Logprobs}
+
+		if opts.N > 1 {
+			req.GenerationConfig.CandidateCount = opts.N
+		}
+	}
+
 	body, err := json.Marshal(req)
 	if err != nil {
-		return "", err
+		return imageprompt.Response{}, err
 	}
 
 	// println(string(body))
 
 	r, err := http.NewRequestWithContext(ctx,
 		http.MethodPost,
-		"https://generativelanguage.googleapis.com/v1beta/models/gemini-2.0-flash:generateContent?key="+ip.AuthKey,
+		"https://generativelanguage.googleapis.com/v1beta/models/gemini-2.0-flash:generateContent",
 		bytes.NewReader(body))
 	if err != nil {
-		return "", err
+		return imageprompt.Response{}, err
 	}
 
 	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-Goog-Api-Key", ip.AuthKey)
 
 	tr := ip.Transport
 	if tr == nil {
@@ -157,36 +200,73 @@ func (ip *ImagePrompter) PromptImage(ctx context.Context, prompt string, jpegIma
 
 	resp, err := tr.RoundTrip(r)
 	if err != nil {
-		return "", err
+		return imageprompt.Response{}, err
 	}
 
 	defer resp.Body.Close() //nolint:errcheck
 
 	cont, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", err
+		return imageprompt.Response{}, err
+	}
+
+	if err := imageprompt.CheckStatus(resp, cont); err != nil {
+		return imageprompt.Response{}, err
 	}
 
 	re := Response{}
 
 	if err := json.Unmarshal(cont, &re); err != nil {
-		return "", err
+		return imageprompt.Response{}, err
 	}
 
 	if len(re.Candidates) == 0 {
-		return "", imageprompt.ErrUnexpectedResponse{
+		return imageprompt.Response{}, imageprompt.ErrUnexpectedResponse{
 			Message:      "no candidates found",
 			ResponseBody: cont,
 		}
 	}
 
-	c := re.Candidates[0]
-	if len(c.Content.Parts) == 0 {
-		return "", imageprompt.ErrUnexpectedResponse{
+	res := imageprompt.Response{
+		Usage: imageprompt.Usage{
+			InputTokens:  re.UsageMetadata.PromptTokenCount,
+			OutputTokens: re.UsageMetadata.CandidatesTokenCount,
+		},
+	}
+
+	for _, c := range re.Candidates {
+		if len(c.Content.Parts) == 0 {
+			continue
+		}
+
+		a := imageprompt.Alternative{
+			Text:         strings.Trim(c.Content.Parts[0].Text, "\" \t\n"),
+			FinishReason: c.FinishReason,
+		}
+
+		// Zero average means that logprobs are not reported.
+		if c.AvgLogprobs != 0 {
+			a.Confidence = imageprompt.Confidence(c.AvgLogprobs)
+		}
+
+		if len(res.Alternatives) == 0 && opts.Logprobs {
+			for _, t := range c.LogprobsResult.ChosenCandidates {
+				res.Logprobs = append(res.Logprobs, imageprompt.TokenLogprob{Token: t.Token, Logprob: t.LogProbability})
+			}
+		}
+
+		res.Alternatives = append(res.Alternatives, a)
+	}
+
+	if len(res.Alternatives) == 0 {
+		return imageprompt.Response{}, imageprompt.ErrUnexpectedResponse{
 			Message:      "no parts found",
 			ResponseBody: cont,
 		}
 	}
 
-	return strings.Trim(c.Content.Parts[0].Text, "\" \t\n"), nil
+	res.Text = res.Alternatives[0].Text
+	res.Confidence = res.Alternatives[0].Confidence
+
+	return res, nil
 }
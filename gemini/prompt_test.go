@@ -0,0 +1,45 @@
+package gemini_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/vearutop/image-prompt/gemini"
+)
+
+type roundTripFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestImagePrompter_PromptImage_redacted(t *testing.T) {
+	const key = "AIzaSyTestSecretKey0123456789"
+
+	ip := gemini.ImagePrompter{
+		AuthKey: key,
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			if strings.Contains(r.URL.String(), key) {
+				t.Error("auth key is in URL")
+			}
+
+			if r.Header.Get("X-Goog-Api-Key") != key {
+				t.Error("auth key is not in header")
+			}
+
+			return nil, errors.New("dial failed for " + r.URL.String() + " with key " + key)
+		}),
+	}
+
+	_, err := ip.PromptImage(context.Background(), "caption", strings.NewReader("jpeg"))
+	if err == nil {
+		t.Fatal("error expected")
+	}
+
+	if strings.Contains(err.Error(), key) {
+		t.Errorf("auth key is not redacted: %s", err)
+	}
+}
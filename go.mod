@@ -3,3 +3,10 @@ module github.com/vearutop/image-prompt
 go 1.23
 
 require github.com/bool64/dev v0.2.39
+
+require (
+	github.com/swaggest/jsonschema-go v0.3.70
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require github.com/swaggest/refl v1.3.0 // indirect
@@ -2,8 +2,11 @@
 package imageprompt
 
 import (
+	"bytes"
 	"context"
 	"io"
+	"math"
+	"net/http"
 )
 
 type sentinelError string
@@ -14,20 +17,188 @@ func (e sentinelError) Error() string { return string(e) }
 const (
 	ErrResourceExhausted = sentinelError("resource exhausted")
 	ErrEmptyConfig       = sentinelError("empty config")
+	ErrCircuitOpen       = sentinelError("circuit breaker open")
+	ErrBudgetExceeded    = sentinelError("budget exceeded")
 )
 
 // ErrUnexpectedResponse contains unexpected response body.
+//
+// Response with status 429 Too Many Requests matches ErrResourceExhausted.
 type ErrUnexpectedResponse struct {
 	Message      string
+	StatusCode   int // HTTP status code, if available.
 	ResponseBody []byte
 }
 
-func (ErrUnexpectedResponse) Error() string {
+func (e ErrUnexpectedResponse) Error() string {
+	if e.Message != "" {
+		return "unexpected response: " + e.Message
+	}
+
 	return "unexpected response"
 }
 
+// Unwrap returns ErrResourceExhausted for status 429 Too Many Requests.
+func (e ErrUnexpectedResponse) Unwrap() error {
+	if e.StatusCode == http.StatusTooManyRequests {
+		return ErrResourceExhausted
+	}
+
+	return nil
+}
+
+// CheckStatus returns ErrUnexpectedResponse if HTTP response status is not successful.
+func CheckStatus(resp *http.Response, body []byte) error {
+	if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+		return nil
+	}
+
+	return ErrUnexpectedResponse{
+		Message:      resp.Status,
+		StatusCode:   resp.StatusCode,
+		ResponseBody: body,
+	}
+}
+
 // Prompter defines LLM driver.
 type Prompter interface {
 	PromptImage(ctx context.Context, prompt string, jpegImage io.Reader) (string, error)
 	ModelName() string
 }
+
+// Usage describes consumed tokens.
+type Usage struct {
+	InputTokens  int `json:"input_tokens,omitempty"`
+	OutputTokens int `json:"output_tokens,omitempty"`
+}
+
+// Response is a detailed LLM response.
+type Response struct {
+	Text  string `json:"text"`
+	Usage Usage  `json:"usage"`
+
+	// Alternatives are all generated responses, the first one is also in Text.
+	Alternatives []Alternative `json:"alternatives,omitempty"`
+
+	// Confidence of Text from 0 to 1, 0 if provider does not report it.
+	Confidence float64 `json:"confidence,omitempty"`
+	// Logprobs of Text tokens, if requested with Options.Logprobs and supported by provider.
+	Logprobs []TokenLogprob `json:"logprobs,omitempty"`
+
+	// Cached is true if response is served from cache.
+	Cached bool `json:"cached,omitempty"`
+}
+
+// Alternative is one of generated responses.
+type Alternative struct {
+	Text         string  `json:"text"`
+	FinishReason string  `json:"finish_reason,omitempty"` // As reported by provider, e.g. "stop" or "length".
+	Confidence   float64 `json:"confidence,omitempty"`
+}
+
+// TokenLogprob is a log probability of a generated token.
+type TokenLogprob struct {
+	Token   string  `json:"token"`
+	Logprob float64 `json:"logprob"`
+}
+
+// Confidence normalizes mean token log probability to a score from 0 to 1.
+func Confidence(avgLogprob float64) float64 {
+	return min(1, math.Exp(avgLogprob))
+}
+
+// Options are optional request parameters, drivers ignore unsupported ones.
+type Options struct {
+	// N is a number of alternatives to generate, default 1.
+	N int `json:"n,omitempty"`
+	// Confidence requests data to calculate confidence, if provider does not report it by default.
+	Confidence bool `json:"confidence,omitempty"`
+	// Logprobs requests per-token log probabilities, implies Confidence.
+	Logprobs bool `json:"logprobs,omitempty"`
+}
+
+type optionsCtxKey struct{}
+
+// WithOptions returns a context that carries request options for drivers.
+func WithOptions(ctx context.Context, o Options) context.Context {
+	return context.WithValue(ctx, optionsCtxKey{}, o)
+}
+
+// OptionsFromContext returns request options from context, or zero options.
+func OptionsFromContext(ctx context.Context) Options {
+	o, _ := ctx.Value(optionsCtxKey{}).(Options)
+
+	return o
+}
+
+// PromptAlternatives calls prompt n times to collect alternatives, for drivers without native support.
+//
+// Seed is 0 for a single call, or from 1 to n otherwise, so that drivers can vary sampling.
+func PromptAlternatives(n int, prompt func(seed int) (Response, error)) (Response, error) {
+	if n <= 1 {
+		return prompt(0)
+	}
+
+	var res Response
+
+	for i := range n {
+		r, err := prompt(i + 1)
+		if err != nil {
+			return Response{}, err
+		}
+
+		if i == 0 {
+			res.Text = r.Text
+			res.Confidence = r.Confidence
+			res.Logprobs = r.Logprobs
+		}
+
+		res.Usage.InputTokens += r.Usage.InputTokens
+		res.Usage.OutputTokens += r.Usage.OutputTokens
+
+		if len(r.Alternatives) == 0 {
+			r.Alternatives = []Alternative{{Text: r.Text, Confidence: r.Confidence}}
+		}
+
+		res.Alternatives = append(res.Alternatives, r.Alternatives...)
+	}
+
+	return res, nil
+}
+
+// ResponsePrompter is a Prompter that can return detailed response.
+type ResponsePrompter interface {
+	Prompter
+	PromptImageResponse(ctx context.Context, prompt string, jpegImage io.Reader) (Response, error)
+}
+
+// PromptImageResponse asks prompter about JPEG image and returns detailed response,
+// it falls back to PromptImage if prompter is not a ResponsePrompter.
+//
+// Alternatives requested with WithOptions are collected with repeated PromptImage calls in fallback mode.
+func PromptImageResponse(ctx context.Context, p Prompter, prompt string, jpegImage io.Reader) (Response, error) {
+	if rp, ok := p.(ResponsePrompter); ok {
+		return rp.PromptImageResponse(ctx, prompt, jpegImage)
+	}
+
+	n := OptionsFromContext(ctx).N
+	if n <= 1 {
+		text, err := p.PromptImage(ctx, prompt, jpegImage)
+		if err != nil {
+			return Response{}, err
+		}
+
+		return Response{Text: text}, nil
+	}
+
+	img, err := io.ReadAll(jpegImage)
+	if err != nil {
+		return Response{}, err
+	}
+
+	return PromptAlternatives(n, func(_ int) (Response, error) {
+		text, err := p.PromptImage(ctx, prompt, bytes.NewReader(img))
+
+		return Response{Text: text}, err
+	})
+}
@@ -0,0 +1,128 @@
+package imageprompt
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces secrets in redacted strings.
+const Redacted = "[REDACTED]"
+
+var (
+	secretsMu sync.RWMutex
+	secrets   = map[string]struct{}{}
+
+	redactPatterns = []*regexp.Regexp{
+		// Key-like URL query parameters.
+		regexp.MustCompile(`(?i)([?&](?:key|api_key|apikey|access_token|token|auth)=)[^&\s"']+`),
+		// Authorization headers and bearer tokens.
+		regexp.MustCompile(`(?i)((?:authorization|x-goog-api-key|api-key)"?\s*[:=]\s*"?(?:bearer\s+)?)[^\s"',]+`),
+		regexp.MustCompile(`(?i)(bearer\s+)[^\s"',]+`),
+		// URL userinfo.
+		regexp.MustCompile(`(://)[^/\s@"']+@`),
+	}
+)
+
+// RegisterSecret adds a value that must never appear in errors and logs.
+//
+// Values shorter than 6 bytes are ignored to avoid redacting common words.
+func RegisterSecret(s string) {
+	if len(s) < 6 {
+		return
+	}
+
+	secretsMu.RLock()
+	_, ok := secrets[s]
+	secretsMu.RUnlock()
+
+	if ok {
+		return
+	}
+
+	secretsMu.Lock()
+	secrets[s] = struct{}{}
+	secretsMu.Unlock()
+}
+
+// Redact removes registered secrets, auth headers, key query parameters and URL userinfo from a string.
+func Redact(s string) string {
+	secretsMu.RLock()
+	for v := range secrets {
+		s = strings.ReplaceAll(s, v, Redacted)
+	}
+	secretsMu.RUnlock()
+
+	for _, re := range redactPatterns {
+		if re.NumSubexp() > 0 {
+			s = re.ReplaceAllString(s, "${1}"+Redacted)
+		}
+	}
+
+	return s
+}
+
+// RedactError returns an error with redacted message.
+//
+// Errors in the chain can still be matched with errors.Is and errors.As, except
+// for wrapping errors that are replaced with redacted copies. Wrapped *url.Error and
+// ErrUnexpectedResponse are replaced with redacted copies too.
+func RedactError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var re redactedError
+	if errors.As(err, &re) && re.msg == err.Error() {
+		return err
+	}
+
+	return redactWrapped(err)
+}
+
+func redactWrapped(err error) error {
+	switch e := err.(type) { //nolint:errorlint // Wrapped errors are traversed explicitly.
+	case redactedError:
+		return e
+	case *url.Error:
+		return &url.Error{Op: e.Op, URL: Redact(e.URL), Err: redactWrapped(e.Err)}
+	case ErrUnexpectedResponse:
+		e.Message = Redact(e.Message)
+		e.ResponseBody = []byte(Redact(string(e.ResponseBody)))
+
+		return e
+	case interface{ Unwrap() error }:
+		return redactedError{msg: Redact(err.Error()), errs: []error{redactWrapped(e.Unwrap())}}
+	case interface{ Unwrap() []error }:
+		errs := e.Unwrap()
+		redacted := make([]error, 0, len(errs))
+
+		for _, w := range errs {
+			redacted = append(redacted, redactWrapped(w))
+		}
+
+		return redactedError{msg: Redact(err.Error()), errs: redacted}
+	default:
+		msg := err.Error()
+		if r := Redact(msg); r != msg {
+			return redactedError{msg: r, errs: []error{err}}
+		}
+
+		return err
+	}
+}
+
+type redactedError struct {
+	msg  string
+	errs []error
+}
+
+func (e redactedError) Error() string {
+	return e.msg
+}
+
+func (e redactedError) Unwrap() []error {
+	return e.errs
+}
@@ -0,0 +1,73 @@
+package imageprompt_test
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/vearutop/image-prompt/imageprompt"
+)
+
+func TestRedact(t *testing.T) {
+	imageprompt.RegisterSecret("sk-registered-secret")
+
+	for _, tc := range []struct {
+		in, secret string
+	}{
+		{in: "failed with sk-registered-secret", secret: "sk-registered-secret"},
+		{in: `Post "https://example.com/v1?alt=json&key=AIzaQueryKey": EOF`, secret: "AIzaQueryKey"},
+		{in: "Authorization: Bearer sk-header-token", secret: "sk-header-token"},
+		{in: `{"headers":{"X-Goog-Api-Key":"AIzaHeaderKey"}}`, secret: "AIzaHeaderKey"},
+		{in: "Post https://cf-userinfo-key@llava.example.workers.dev/: timeout", secret: "cf-userinfo-key"},
+	} {
+		out := imageprompt.Redact(tc.in)
+		if strings.Contains(out, tc.secret) {
+			t.Errorf("secret is not redacted: %s", out)
+		}
+
+		if !strings.Contains(out, imageprompt.Redacted) {
+			t.Errorf("redaction marker is missing: %s", out)
+		}
+	}
+}
+
+func TestRedactError(t *testing.T) {
+	imageprompt.RegisterSecret("sk-error-secret")
+
+	ue := &url.Error{Op: "Post", URL: "https://example.com/?key=sk-error-secret", Err: errors.New("connection reset")}
+	err := imageprompt.RedactError(fmt.Errorf("request: %w", ue))
+
+	if strings.Contains(err.Error(), "sk-error-secret") {
+		t.Errorf("secret is not redacted: %s", err)
+	}
+
+	var target *url.Error
+	if !errors.As(err, &target) {
+		t.Fatal("url.Error is not matched")
+	}
+
+	if strings.Contains(target.Error(), "sk-error-secret") {
+		t.Errorf("secret is not redacted in wrapped error: %s", target)
+	}
+
+	err = imageprompt.RedactError(fmt.Errorf("prompt: %w", imageprompt.ErrResourceExhausted))
+	if !errors.Is(err, imageprompt.ErrResourceExhausted) {
+		t.Error("sentinel error is not matched")
+	}
+
+	err = imageprompt.RedactError(imageprompt.ErrUnexpectedResponse{
+		Message:      "bad key sk-error-secret",
+		ResponseBody: []byte(`{"error":"invalid key sk-error-secret"}`),
+	})
+
+	var ur imageprompt.ErrUnexpectedResponse
+	if !errors.As(err, &ur) {
+		t.Fatal("ErrUnexpectedResponse is not matched")
+	}
+
+	if strings.Contains(ur.Message, "sk-error-secret") || strings.Contains(string(ur.ResponseBody), "sk-error-secret") {
+		t.Errorf("secret is not redacted in response: %s %s", ur.Message, ur.ResponseBody)
+	}
+}
@@ -0,0 +1,315 @@
+package multi
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+)
+
+// Bandit strategies learn from feedback reported with ImagePrompter.ReportFeedback.
+//
+// Configured weights are used as priors, so that without feedback preferred prompts and providers win more often.
+const (
+	StrategyThompson = "thompson" // Thompson sampling of Beta posterior of score.
+	StrategyUCB      = "ucb"      // Upper confidence bound of mean score.
+)
+
+// Feedback is accumulated feedback of a prompt or provider.
+type Feedback struct {
+	Count int64   `json:"count"`
+	Score float64 `json:"score"` // Sum of scores.
+}
+
+// Mean returns mean score, or 0 if there is no feedback.
+func (f Feedback) Mean() float64 {
+	if f.Count == 0 {
+		return 0
+	}
+
+	return f.Score / float64(f.Count)
+}
+
+// ErrUnknownResult is returned for feedback on a result that is not tracked.
+type ErrUnknownResult struct {
+	ID string
+}
+
+func (e ErrUnknownResult) Error() string {
+	return "unknown result " + e.ID
+}
+
+// maxPendingResults is a number of recent results that can receive feedback.
+const maxPendingResults = 10000
+
+type pendingResult struct {
+	promptName string
+	provider   string
+}
+
+// feedbackTracker accumulates feedback per prompt and provider and persists it to a file.
+type feedbackTracker struct {
+	mu    sync.Mutex
+	state stateFile
+
+	Prompts   map[string]Feedback `json:"prompts"`   // Prompt name, feedback.
+	Providers map[string]Feedback `json:"providers"` // Provider ID, feedback.
+
+	pending map[string]pendingResult
+	order   []string // Pending result IDs, oldest first.
+}
+
+// load reads state file once, or again if file name is changed.
+func (t *feedbackTracker) load(file string) error {
+	err := t.state.load(file, t, func() {
+		t.Prompts = map[string]Feedback{}
+		t.Providers = map[string]Feedback{}
+	})
+
+	if t.Prompts == nil {
+		t.Prompts = map[string]Feedback{}
+	}
+
+	if t.Providers == nil {
+		t.Providers = map[string]Feedback{}
+	}
+
+	return err
+}
+
+// track makes result available for feedback.
+func (t *feedbackTracker) track(id string, r pendingResult) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.pending == nil {
+		t.pending = map[string]pendingResult{}
+	}
+
+	if len(t.order) >= maxPendingResults {
+		delete(t.pending, t.order[0])
+		t.order = t.order[1:]
+	}
+
+	t.pending[id] = r
+	t.order = append(t.order, id)
+}
+
+// feedback returns accumulated feedback of prompts and providers.
+func (t *feedbackTracker) feedback(file string) (prompts, providers map[string]Feedback, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	err = t.load(file)
+
+	prompts = make(map[string]Feedback, len(t.Prompts))
+	for k, v := range t.Prompts {
+		prompts[k] = v
+	}
+
+	providers = make(map[string]Feedback, len(t.Providers))
+	for k, v := range t.Providers {
+		providers[k] = v
+	}
+
+	return prompts, providers, err
+}
+
+// add registers feedback of a tracked result and persists it.
+func (t *feedbackTracker) add(file, id string, score float64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	r, ok := t.pending[id]
+	if !ok {
+		return ErrUnknownResult{ID: id}
+	}
+
+	delete(t.pending, id)
+
+	return t.score(file, r, score)
+}
+
+// addResolved registers feedback of a result found in experiment log and persists it.
+func (t *feedbackTracker) addResolved(file string, r pendingResult, score float64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.score(file, r, score)
+}
+
+// score registers feedback and persists it, t.mu must be locked.
+func (t *feedbackTracker) score(file string, r pendingResult, score float64) error {
+	err := t.load(file)
+
+	if r.promptName != "" {
+		f := t.Prompts[r.promptName]
+		f.Count++
+		f.Score += score
+		t.Prompts[r.promptName] = f
+	}
+
+	if r.provider != "" {
+		f := t.Providers[r.provider]
+		f.Count++
+		f.Score += score
+		t.Providers[r.provider] = f
+	}
+
+	return errors.Join(err, t.state.save(t))
+}
+
+func newResultID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// ReportFeedback registers a score of a result, from 0 (rejected) to 1 (accepted).
+//
+// Feedback is accumulated for prompt and provider of the result and is used by bandit strategies.
+// Each result accepts a single feedback, ErrUnknownResult is returned for unknown or old results.
+//
+// Recent results are tracked in memory, results of other processes or before restart are looked up
+// in Config.ExperimentLog if it is configured.
+func (ip *ImagePrompter) ReportFeedback(resultID string, score float64) error {
+	if math.IsNaN(score) || score < 0 || score > 1 {
+		return fmt.Errorf("feedback score must be from 0 to 1, %v received", score)
+	}
+
+	cfg := ip.cfgAccessor()
+
+	err := ip.feedback.add(cfg.Bandit.StateFile, resultID, score)
+
+	var ue ErrUnknownResult
+	if errors.As(err, &ue) {
+		r, found, lerr := findResult(cfg.ExperimentLog, resultID)
+		if lerr != nil || !found {
+			return errors.Join(err, lerr)
+		}
+
+		err = ip.feedback.addResolved(cfg.Bandit.StateFile, r, score)
+	}
+
+	ip.logFeedback(cfg, resultID, score)
+
+	return err
+}
+
+// Feedback returns accumulated feedback by prompt name and by provider ID.
+func (ip *ImagePrompter) Feedback() (prompts, providers map[string]Feedback, err error) {
+	return ip.feedback.feedback(ip.cfgAccessor().Bandit.StateFile)
+}
+
+func (c BanditConfig) withDefaults() BanditConfig {
+	if c.PriorStrength <= 0 {
+		c.PriorStrength = 10
+	}
+
+	if c.Exploration <= 0 {
+		c.Exploration = 1
+	}
+
+	return c
+}
+
+type arm struct {
+	weight   int
+	feedback Feedback
+}
+
+// banditPick selects an arm with Thompson sampling or UCB, or returns -1 if no arm has positive weight.
+//
+// Configured weight share of an arm defines Beta prior of its score with PriorStrength pseudo-observations.
+func (ip *ImagePrompter) banditPick(algo string, cfg BanditConfig, arms []arm) int {
+	total := 0
+	for _, a := range arms {
+		if a.weight > 0 {
+			total += a.weight
+		}
+	}
+
+	if total <= 0 {
+		return -1
+	}
+
+	observations := 0.0
+
+	for _, a := range arms {
+		if a.weight > 0 {
+			observations += 2 + cfg.PriorStrength + float64(a.feedback.Count)
+		}
+	}
+
+	best, bestScore := -1, math.Inf(-1)
+
+	ip.rngMu.Lock()
+	defer ip.rngMu.Unlock()
+
+	for i, a := range arms {
+		if a.weight <= 0 {
+			continue
+		}
+
+		share := float64(a.weight) / float64(total)
+		alpha := 1 + cfg.PriorStrength*share + a.feedback.Score
+		beta := 1 + cfg.PriorStrength*(1-share) + float64(a.feedback.Count) - a.feedback.Score
+
+		var score float64
+
+		if algo == StrategyUCB {
+			n := alpha + beta
+			score = alpha/n + cfg.Exploration*math.Sqrt(2*math.Log(observations)/n)
+		} else {
+			x := ip.gamma(alpha)
+			score = x / (x + ip.gamma(beta))
+		}
+
+		if score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+
+	return best
+}
+
+// gamma samples Gamma(a, 1) distribution with Marsaglia-Tsang method, a >= 1, rngMu must be locked.
+func (ip *ImagePrompter) gamma(a float64) float64 {
+	d := a - 1.0/3
+	c := 1 / math.Sqrt(9*d)
+
+	for {
+		x := ip.rng.NormFloat64()
+
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+
+		v = v * v * v
+		u := ip.rng.Float64()
+
+		if u < 1-0.0331*x*x*x*x || math.Log(u) < 0.5*x*x+d*(1-v+math.Log(v)) {
+			return d * v
+		}
+	}
+}
+
+// banditStrategy routes providers with feedback.
+type banditStrategy struct {
+	algo string
+	cfg  BanditConfig
+	ip   *ImagePrompter
+}
+
+func (s banditStrategy) Pick(candidates []Candidate) int {
+	arms := make([]arm, len(candidates))
+	for i, c := range candidates {
+		arms[i] = arm{weight: c.Weight, feedback: c.Feedback}
+	}
+
+	return s.ip.banditPick(s.algo, s.cfg, arms)
+}
@@ -0,0 +1,249 @@
+package multi
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/vearutop/image-prompt/imageprompt"
+	"github.com/vearutop/image-prompt/retry"
+)
+
+// BreakerState is a state of provider circuit breaker.
+type BreakerState string
+
+// Circuit breaker states.
+const (
+	BreakerClosed   = BreakerState("closed")    // Provider receives traffic.
+	BreakerOpen     = BreakerState("open")      // Provider is skipped.
+	BreakerHalfOpen = BreakerState("half-open") // Provider receives limited probe requests.
+)
+
+func (c BreakerConfig) enabled() bool {
+	return c.ConsecutiveFailures > 0 || c.ErrorRate > 0
+}
+
+func (c BreakerConfig) withDefaults() BreakerConfig {
+	if c.Window <= 0 {
+		c.Window = Duration(time.Minute)
+	}
+
+	if c.MinRequests <= 0 {
+		c.MinRequests = 10
+	}
+
+	if c.OpenFor <= 0 {
+		c.OpenFor = Duration(30 * time.Second)
+	}
+
+	if c.Probes <= 0 {
+		c.Probes = 1
+	}
+
+	return c
+}
+
+type outcome struct {
+	at     time.Time
+	failed bool
+}
+
+// breaker is a circuit breaker of a provider.
+type breaker struct {
+	mu sync.Mutex
+
+	state          BreakerState
+	consecutive    int
+	outcomes       []outcome
+	openedAt       time.Time
+	probesInFlight int
+	probesOK       int
+}
+
+func newBreaker() *breaker {
+	return &breaker{state: BreakerClosed}
+}
+
+// currentState returns state, moving open breaker to half-open after OpenFor duration.
+func (b *breaker) currentState(cfg BreakerConfig, now time.Time) BreakerState {
+	if b.state == BreakerOpen && now.Sub(b.openedAt) >= time.Duration(cfg.OpenFor) {
+		b.state = BreakerHalfOpen
+		b.probesInFlight = 0
+		b.probesOK = 0
+	}
+
+	return b.state
+}
+
+// available checks if provider can receive a request.
+func (b *breaker) available(cfg BreakerConfig, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.currentState(cfg, now) {
+	case BreakerOpen:
+		return false
+	case BreakerHalfOpen:
+		return b.probesInFlight+b.probesOK < cfg.Probes
+	default:
+		return true
+	}
+}
+
+// acquire registers a request, it returns false if request is not allowed.
+func (b *breaker) acquire(cfg BreakerConfig, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.currentState(cfg, now) {
+	case BreakerOpen:
+		return false
+	case BreakerHalfOpen:
+		if b.probesInFlight+b.probesOK >= cfg.Probes {
+			return false
+		}
+
+		b.probesInFlight++
+
+		return true
+	default:
+		return true
+	}
+}
+
+// report registers request outcome.
+func (b *breaker) report(cfg BreakerConfig, now time.Time, r verdict) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	failed := r == verdictFailure
+
+	if b.state == BreakerHalfOpen {
+		b.probesInFlight = max(0, b.probesInFlight-1)
+
+		if r == verdictNeutral {
+			return
+		}
+
+		if failed {
+			b.open(now)
+
+			return
+		}
+
+		b.probesOK++
+		if b.probesOK >= cfg.Probes {
+			b.state = BreakerClosed
+			b.consecutive = 0
+			b.outcomes = b.outcomes[:0]
+		}
+
+		return
+	}
+
+	if b.state == BreakerOpen || r == verdictNeutral {
+		// Late result of a request started before opening, or an outcome that does not reflect provider health.
+		return
+	}
+
+	if failed {
+		b.consecutive++
+	} else {
+		b.consecutive = 0
+	}
+
+	b.outcomes = append(b.outcomes, outcome{at: now, failed: failed})
+
+	// Drop outcomes outside window.
+	i := 0
+	for i < len(b.outcomes) && now.Sub(b.outcomes[i].at) > time.Duration(cfg.Window) {
+		i++
+	}
+
+	b.outcomes = b.outcomes[i:]
+
+	if cfg.ConsecutiveFailures > 0 && b.consecutive >= cfg.ConsecutiveFailures {
+		b.open(now)
+
+		return
+	}
+
+	if cfg.ErrorRate > 0 && len(b.outcomes) >= cfg.MinRequests {
+		failures := 0
+
+		for _, o := range b.outcomes {
+			if o.failed {
+				failures++
+			}
+		}
+
+		if float64(failures)/float64(len(b.outcomes)) >= cfg.ErrorRate {
+			b.open(now)
+		}
+	}
+}
+
+func (b *breaker) open(now time.Time) {
+	b.state = BreakerOpen
+	b.openedAt = now
+	b.consecutive = 0
+	b.outcomes = b.outcomes[:0]
+	b.probesInFlight = 0
+	b.probesOK = 0
+}
+
+// verdict classifies request outcome for provider health.
+type verdict int
+
+const (
+	verdictSuccess verdict = iota
+	verdictFailure
+	verdictNeutral
+)
+
+// classify checks if request error indicates provider failure.
+//
+// Invalid requests are successes from provider health perspective,
+// exhausted quota and canceled parent context are neutral.
+func classify(parent context.Context, err error) verdict {
+	switch {
+	case err == nil:
+		return verdictSuccess
+	case parent.Err() != nil, errors.Is(err, imageprompt.ErrResourceExhausted):
+		return verdictNeutral
+	case retry.Retryable(err), errors.Is(err, context.DeadlineExceeded):
+		return verdictFailure
+	default:
+		return verdictSuccess
+	}
+}
+
+func (ip *ImagePrompter) breaker(id string) *breaker {
+	b, _ := ip.breakers.LoadOrStore(id, newBreaker())
+
+	return b
+}
+
+// BreakerStates returns circuit breaker states by provider ID.
+//
+// Providers without configured breaker are not listed.
+func (ip *ImagePrompter) BreakerStates() map[string]BreakerState {
+	res := map[string]BreakerState{}
+	now := time.Now()
+
+	for _, wp := range ip.cfgAccessor().Providers {
+		cfg := wp.Provider.Breaker
+		if !cfg.enabled() {
+			continue
+		}
+
+		b := ip.breaker(wp.Provider.ID())
+
+		b.mu.Lock()
+		res[wp.Provider.ID()] = b.currentState(cfg.withDefaults(), now)
+		b.mu.Unlock()
+	}
+
+	return res
+}
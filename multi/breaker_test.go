@@ -0,0 +1,128 @@
+package multi
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	type step struct {
+		at    time.Duration // Time since start.
+		do    string        // ok, fail, neutral, acquire or deny (acquire that must be refused).
+		state BreakerState  // State after step.
+	}
+
+	for _, tc := range []struct {
+		name  string
+		cfg   BreakerConfig
+		steps []step
+	}{
+		{
+			name: "consecutive failures",
+			cfg:  BreakerConfig{ConsecutiveFailures: 2, OpenFor: Duration(10 * time.Second)},
+			steps: []step{
+				{do: "fail", state: BreakerClosed},
+				{do: "ok", state: BreakerClosed},
+				{do: "fail", state: BreakerClosed},
+				{do: "fail", state: BreakerOpen},
+				{at: 5 * time.Second, do: "deny", state: BreakerOpen},
+				{at: 10 * time.Second, do: "acquire", state: BreakerHalfOpen},
+				{at: 10 * time.Second, do: "deny", state: BreakerHalfOpen},
+				{at: 11 * time.Second, do: "ok", state: BreakerClosed},
+			},
+		},
+		{
+			name: "failed probe reopens",
+			cfg:  BreakerConfig{ConsecutiveFailures: 1, OpenFor: Duration(10 * time.Second)},
+			steps: []step{
+				{do: "fail", state: BreakerOpen},
+				{at: 10 * time.Second, do: "acquire", state: BreakerHalfOpen},
+				{at: 11 * time.Second, do: "fail", state: BreakerOpen},
+				{at: 15 * time.Second, do: "deny", state: BreakerOpen},
+				{at: 21 * time.Second, do: "acquire", state: BreakerHalfOpen},
+				{at: 21 * time.Second, do: "ok", state: BreakerClosed},
+			},
+		},
+		{
+			name: "probe limit",
+			cfg:  BreakerConfig{ConsecutiveFailures: 1, OpenFor: Duration(10 * time.Second), Probes: 2},
+			steps: []step{
+				{do: "fail", state: BreakerOpen},
+				{at: 10 * time.Second, do: "acquire", state: BreakerHalfOpen},
+				{at: 10 * time.Second, do: "acquire", state: BreakerHalfOpen},
+				{at: 10 * time.Second, do: "deny", state: BreakerHalfOpen},
+				{at: 11 * time.Second, do: "ok", state: BreakerHalfOpen},
+				{at: 11 * time.Second, do: "deny", state: BreakerHalfOpen},
+				{at: 12 * time.Second, do: "ok", state: BreakerClosed},
+			},
+		},
+		{
+			name: "neutral outcomes",
+			cfg:  BreakerConfig{ConsecutiveFailures: 2, OpenFor: Duration(10 * time.Second)},
+			steps: []step{
+				{do: "fail", state: BreakerClosed},
+				{do: "neutral", state: BreakerClosed},
+				{do: "fail", state: BreakerOpen},
+				{at: 10 * time.Second, do: "acquire", state: BreakerHalfOpen},
+				{at: 10 * time.Second, do: "neutral", state: BreakerHalfOpen},
+				{at: 10 * time.Second, do: "acquire", state: BreakerHalfOpen},
+				{at: 10 * time.Second, do: "ok", state: BreakerClosed},
+			},
+		},
+		{
+			name: "error rate",
+			cfg:  BreakerConfig{ErrorRate: 0.5, MinRequests: 4, Window: Duration(time.Minute)},
+			steps: []step{
+				{do: "ok", state: BreakerClosed},
+				{do: "fail", state: BreakerClosed},
+				{do: "fail", state: BreakerClosed},
+				{do: "ok", state: BreakerOpen},
+			},
+		},
+		{
+			name: "error rate window",
+			cfg:  BreakerConfig{ErrorRate: 0.5, MinRequests: 4, Window: Duration(time.Minute)},
+			steps: []step{
+				{do: "fail", state: BreakerClosed},
+				{do: "fail", state: BreakerClosed},
+				{at: 2 * time.Minute, do: "ok", state: BreakerClosed},
+				{at: 2 * time.Minute, do: "ok", state: BreakerClosed},
+				{at: 2 * time.Minute, do: "ok", state: BreakerClosed},
+				{at: 2 * time.Minute, do: "fail", state: BreakerClosed},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				b     = newBreaker()
+				cfg   = tc.cfg.withDefaults()
+				start = time.Now()
+			)
+
+			for i, s := range tc.steps {
+				now := start.Add(s.at)
+
+				switch s.do {
+				case "ok":
+					b.report(cfg, now, verdictSuccess)
+				case "fail":
+					b.report(cfg, now, verdictFailure)
+				case "neutral":
+					b.report(cfg, now, verdictNeutral)
+				case "acquire", "deny":
+					if b.available(cfg, now) != (s.do == "acquire") {
+						t.Fatalf("step %d: unexpected availability", i)
+					}
+
+					if b.acquire(cfg, now) != (s.do == "acquire") {
+						t.Fatalf("step %d: unexpected acquire result", i)
+					}
+				}
+
+				if st := b.currentState(cfg, now); st != s.state {
+					t.Fatalf("step %d: %s expected, %s received", i, s.state, st)
+				}
+			}
+		})
+	}
+}
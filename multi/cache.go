@@ -0,0 +1,93 @@
+package multi
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/vearutop/image-prompt/cache"
+	"github.com/vearutop/image-prompt/imageprompt"
+)
+
+func (c CacheConfig) enabled() bool {
+	return c.Dir != ""
+}
+
+// cacheStore returns custom cache store or reusable filesystem store for settings, nil if cache is disabled.
+func (ip *ImagePrompter) cacheStore(c CacheConfig) (cache.Store, error) {
+	if ip.Cache != nil {
+		return ip.Cache, nil
+	}
+
+	if !c.enabled() {
+		return nil, nil //nolint:nilnil // Disabled cache is not an error.
+	}
+
+	fp := fingerprint(c)
+
+	if s, ok := ip.caches.Load(fp); ok {
+		return s, nil
+	}
+
+	s, err := cache.NewFS(c.Dir, time.Duration(c.TTL), c.MaxSize)
+	if err != nil {
+		return nil, err
+	}
+
+	s, _ = ip.caches.LoadOrStore(fp, s)
+
+	return s, nil
+}
+
+// resultKey identifies request for result cache, it does not depend on a provider that served the result.
+func resultKey(ctx context.Context, prompt string, routing Routing, img []byte) string {
+	r, _ := json.Marshal(routing) //nolint:errchkjson // Routing is always serializable.
+
+	return cache.Key(img, prompt, "multi "+string(r), imageprompt.OptionsFromContext(ctx))
+}
+
+// cached returns final result of an earlier identical request.
+func (ip *ImagePrompter) cached(ctx context.Context, cfg Config, key string) (Result, bool) {
+	store, err := ip.cacheStore(cfg.Cache)
+	if err != nil || store == nil {
+		ip.reportError(err)
+
+		return Result{}, false
+	}
+
+	data, found, err := store.Get(ctx, key)
+	if err != nil || !found {
+		ip.reportError(err)
+
+		return Result{}, false
+	}
+
+	var res Result
+	if err := json.Unmarshal(data, &res); err != nil {
+		ip.reportError(err)
+
+		return Result{}, false
+	}
+
+	res.Cached = true
+	res.Cost = 0
+
+	return res, true
+}
+
+// storeResult caches final result, it must only be called for results that passed validation.
+func (ip *ImagePrompter) storeResult(ctx context.Context, cfg Config, key string, res Result) {
+	store, err := ip.cacheStore(cfg.Cache)
+	if err != nil || store == nil {
+		ip.reportError(err)
+
+		return
+	}
+
+	data, err := json.Marshal(res)
+	if err == nil {
+		err = store.Set(ctx, key, data)
+	}
+
+	ip.reportError(err)
+}
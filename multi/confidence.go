@@ -0,0 +1,94 @@
+package multi
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/vearutop/image-prompt/imageprompt"
+)
+
+func (c ConfidenceConfig) enabled() bool {
+	return c.Threshold > 0
+}
+
+// withConfidence requests confidence from drivers if it is needed for re-routing.
+func (c ConfidenceConfig) withConfidence(ctx context.Context) context.Context {
+	if !c.enabled() {
+		return ctx
+	}
+
+	o := imageprompt.OptionsFromContext(ctx)
+	if o.Confidence {
+		return ctx
+	}
+
+	o.Confidence = true
+
+	return imageprompt.WithOptions(ctx, o)
+}
+
+// escalate re-routes low-confidence result to a stronger provider.
+//
+// Original result is kept in Candidates, it is returned as is if escalation fails.
+func (ip *ImagePrompter) escalate(ctx context.Context, cfg Config, res Result, img []byte) Result {
+	cc := cfg.Confidence
+	if !cc.enabled() || res.Confidence == 0 || res.Confidence >= cc.Threshold {
+		return res
+	}
+
+	stronger := Routing{Names: cc.Names, Tags: cc.Tags}
+	dedicated := len(cc.Names) > 0 || len(cc.Tags) > 0
+
+	for _, pr := range cfg.Providers {
+		if dedicated && pr.Provider.ID() == res.Provider && stronger.matches(pr.Provider) {
+			return res // Already served by a stronger provider.
+		}
+	}
+
+	stronger.Exclude = []string{res.Provider}
+
+	// Stronger providers can have zero weight to only serve escalations,
+	// without names and tags any other provider with positive weight is used.
+	pcfg := cfg
+	if dedicated {
+		pcfg = withDedicated(cfg, stronger)
+	}
+
+	provider, err := ip.pickProvider(pcfg, stronger)
+	if err != nil {
+		ip.reportError(fmt.Errorf("low confidence escalation: %w", err))
+
+		return res
+	}
+
+	er, err := ip.do(ctx, cfg, ip.prompter(res.Prompt, res.PromptName, provider), img)
+	if err != nil {
+		ip.reportError(fmt.Errorf("low confidence escalation: %w", err))
+
+		return res
+	}
+
+	er.Escalated = true
+	er.Hedged = res.Hedged
+	er.Candidates = []Result{res}
+	er.Usage.InputTokens += res.Usage.InputTokens
+	er.Usage.OutputTokens += res.Usage.OutputTokens
+	er.Cost += res.Cost
+
+	return er
+}
+
+// withDedicated returns config where providers matching routing have positive weight,
+// so that providers with zero weight can be dedicated to special requests.
+func withDedicated(cfg Config, r Routing) Config {
+	cfg.Providers = slices.Clone(cfg.Providers)
+
+	for i, pr := range cfg.Providers {
+		if pr.Weight == 0 && r.matches(pr.Provider) {
+			cfg.Providers[i].Weight = 1
+		}
+	}
+
+	return cfg
+}
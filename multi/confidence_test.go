@@ -0,0 +1,73 @@
+package multi
+
+import (
+	"context"
+	"testing"
+)
+
+func TestImagePrompter_escalate(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		cfg      ConfidenceConfig
+		weights  map[string]int // Providers weak, other and strong.
+		provider string         // Expected provider of result.
+	}{
+		{
+			name:     "any other provider",
+			cfg:      ConfidenceConfig{Threshold: 0.5},
+			weights:  map[string]int{"weak": 1, "other": 1},
+			provider: "other",
+		},
+		{
+			name:     "no other provider",
+			cfg:      ConfidenceConfig{Threshold: 0.5},
+			weights:  map[string]int{"weak": 1},
+			provider: "weak",
+		},
+		{
+			name:     "zero weight without names",
+			cfg:      ConfidenceConfig{Threshold: 0.5},
+			weights:  map[string]int{"weak": 1, "strong": 0},
+			provider: "weak",
+		},
+		{
+			name:     "dedicated by name",
+			cfg:      ConfidenceConfig{Threshold: 0.5, Names: []string{"strong"}},
+			weights:  map[string]int{"weak": 1, "other": 1, "strong": 0},
+			provider: "strong",
+		},
+		{
+			name:     "already stronger",
+			cfg:      ConfidenceConfig{Threshold: 0.5, Names: []string{"weak", "strong"}},
+			weights:  map[string]int{"weak": 1, "strong": 1},
+			provider: "weak",
+		},
+		{
+			name:     "confident",
+			cfg:      ConfidenceConfig{Threshold: 0.05},
+			weights:  map[string]int{"weak": 1, "other": 1},
+			provider: "weak",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := Config{Confidence: tc.cfg}
+
+			for _, name := range []string{"weak", "other", "strong"} {
+				if w, ok := tc.weights[name]; ok {
+					cfg.Providers = append(cfg.Providers, WeightedProvider{
+						Provider: Provider{Name: name, Prompter: &textPrompter{text: name}},
+						Weight:   w,
+					})
+				}
+			}
+
+			ip := NewImagePrompter(func() Config { return cfg })
+
+			res := ip.escalate(context.Background(), cfg, Result{Text: "weak", Provider: "weak", Confidence: 0.1}, nil)
+
+			if res.Provider != tc.provider || res.Text != tc.provider || res.Escalated != (tc.provider != "weak") {
+				t.Fatalf("result of %s expected, %+v received", tc.provider, res)
+			}
+		})
+	}
+}
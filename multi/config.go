@@ -1,9 +1,32 @@
 package multi
 
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	"github.com/vearutop/image-prompt/imageprompt"
+)
+
 // WeightedPrompt is a prompt with usage probability.
 type WeightedPrompt struct {
-	Prompt string `json:"prompt" default:"Generate a detailed caption for this image, don't name the places, items or people unless you're sure." title:"Prompt text"`
-	Weight int    `json:"weight" default:"1" title:"Prompt weight, prompts with higher weight are picked more often"`
+	Name   string   `json:"name,omitempty" title:"Prompt name, can be used to pin the prompt in request routing"`
+	Prompt string   `json:"prompt" default:"Generate a detailed caption for this image, don't name the places, items or people unless you're sure." title:"Prompt text"`
+	Weight int      `json:"weight" default:"1" title:"Prompt weight, prompts with higher weight are picked more often"`
+	Tags   []string `json:"tags,omitempty" title:"Prompt tags"`
+}
+
+// ID returns prompt name, or a name derived from prompt text if name is empty.
+func (p WeightedPrompt) ID() string {
+	if p.Name != "" {
+		return p.Name
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(p.Prompt))
+
+	return fmt.Sprintf("prompt-%08x", h.Sum32())
 }
 
 // WeightedProvider is a Provider with usage probability.
@@ -35,15 +58,234 @@ func (p ProviderType) Enum() []any {
 
 // Provider describes LLM service.
 type Provider struct {
-	Type        ProviderType `json:"type" title:"Type of provider"`
-	AuthKey     string       `json:"auth_key,omitempty" title:"Auth/API key when applicable"`
-	BaseURL     string       `json:"base_url,omitempty" title:"Base URL (for cloudflare, ollama)"`
-	Model       string       `json:"model,omitempty" title:"Model"`
-	Concurrency int          `json:"concurrency,omitempty" title:"Max request concurrency" default:"1"`
+	Name                string        `json:"name,omitempty" title:"Provider name, must be unique, defaults to type and model"`
+	Tags                []string      `json:"tags,omitempty" title:"Provider tags, can be used in request routing"`
+	Type                ProviderType  `json:"type" title:"Type of provider"`
+	AuthKey             string        `json:"auth_key,omitempty" title:"Auth/API key when applicable, can be a secret reference: env:NAME, file:/path or cmd:command"`
+	AuthKeys            []string      `json:"auth_keys,omitempty" title:"Additional auth/API keys, requests are rotated across all keys with exhaustion tracked per key"`
+	BaseURL             string        `json:"base_url,omitempty" title:"Base URL (for cloudflare, ollama), cloudflare userinfo can be a secret reference"`
+	Model               string        `json:"model,omitempty" title:"Model"`
+	Concurrency         int           `json:"concurrency,omitempty" title:"Max request concurrency" default:"1"`
+	AdaptiveConcurrency AIMDConfig    `json:"adaptive_concurrency" title:"Adaptive concurrency limit, replaces fixed concurrency when enabled"`
+	HTTP                HTTPSettings  `json:"http" title:"HTTP client settings"`
+	Retry               RetryPolicy   `json:"retry" title:"Retry policy for transient failures"`
+	Breaker             BreakerConfig `json:"breaker" title:"Circuit breaker, disabled by default"`
+	Budget              Budget        `json:"budget" title:"Provider budget, provider is excluded from routing when reached"`
+
+	// Prompter is a custom prompter to use instead of Type, for example a nested *ImagePrompter.
+	Prompter imageprompt.Prompter `json:"-"`
+}
+
+// ID returns provider name, or a name derived from type and model if name is empty.
+//
+// Provider state, such as concurrency semaphore and exhaustion, is tracked by ID.
+func (p Provider) ID() string {
+	if p.Name != "" {
+		return p.Name
+	}
+
+	t := string(p.Type)
+	if t == "" {
+		t = "custom"
+	}
+
+	if p.Model != "" {
+		return t + "/" + p.Model
+	}
+
+	return t
 }
 
 // Config defines prompts and services.
 type Config struct {
 	Prompts   []WeightedPrompt   `json:"prompts" minLength:"1" title:"Prompts"`
 	Providers []WeightedProvider `json:"providers" minLength:"1" title:"LLM Providers"`
+	Prices    map[string]Price   `json:"prices,omitempty" title:"Prices by model name, used to calculate request cost"`
+	Budget    Budget             `json:"budget" title:"Total budget, providers of paid models are excluded from routing when reached"`
+	SpendFile string             `json:"spend_file,omitempty" title:"Path to file to persist spend, so that budgets survive restarts"`
+	Hedge     HedgeConfig        `json:"hedge" title:"Hedged requests, disabled by default"`
+	Strategy  string             `json:"strategy,omitempty" title:"Provider routing strategy: weighted (default), adaptive, thompson, ucb or a name of custom registered strategy"`
+	Adaptive  AdaptiveConfig     `json:"adaptive" title:"Adaptive routing strategy settings"`
+
+	PromptStrategy string           `json:"prompt_strategy,omitempty" title:"Prompt selection strategy: weighted (default), thompson or ucb"`
+	Bandit         BanditConfig     `json:"bandit" title:"Settings of thompson and ucb strategies that learn from feedback"`
+	ExperimentLog  string           `json:"experiment_log,omitempty" title:"Path to JSONL file to log results and feedback for prompt experiments"`
+	Shadow         ShadowConfig     `json:"shadow" title:"Shadow traffic to candidate providers, disabled by default"`
+	Ensemble       EnsembleConfig   `json:"ensemble" title:"Ensemble captioning, enabled per request with Routing.Ensemble"`
+	Confidence     ConfidenceConfig `json:"confidence" title:"Re-routing of low-confidence captions to stronger providers, disabled by default"`
+	Validation     ValidationConfig `json:"validation" title:"Output validation with re-routing of rejected outputs, disabled by default"`
+	Critique       CritiqueConfig   `json:"critique" title:"Self-critique and refinement of captions, disabled by default"`
+	Cache          CacheConfig      `json:"cache" title:"Filesystem cache of provider responses, disabled by default"`
+	Dedup          bool             `json:"dedup,omitempty" title:"Coalesce identical concurrent requests into one provider call"`
+}
+
+// Duration is a time.Duration represented as a string in JSON, e.g. "1m30s".
+//
+// Numbers are accepted as seconds.
+type Duration time.Duration
+
+// MarshalJSON encodes duration as string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON decodes duration from string or number of seconds.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	switch v := v.(type) {
+	case string:
+		td, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+
+		*d = Duration(td)
+	case float64:
+		*d = Duration(v * float64(time.Second))
+	default:
+		return fmt.Errorf("duration string or number of seconds expected, %s received", string(data))
+	}
+
+	return nil
+}
+
+// HTTPSettings configures HTTP client of a provider.
+type HTTPSettings struct {
+	Timeout            Duration          `json:"timeout,omitempty" title:"Request timeout, default 5m"`
+	ProxyURL           string            `json:"proxy_url,omitempty" title:"HTTP proxy URL"`
+	CABundle           string            `json:"ca_bundle,omitempty" title:"Path to PEM file with additional trusted CA certificates"`
+	InsecureSkipVerify bool              `json:"insecure_skip_verify,omitempty" title:"Skip TLS certificate verification, only for lab hosts"`
+	Headers            map[string]string `json:"headers,omitempty" title:"Extra request headers, values can be secret references"`
+}
+
+// RetryPolicy configures retries of transient failures, such as network errors and 5xx responses.
+type RetryPolicy struct {
+	Attempts   int      `json:"attempts,omitempty" title:"Max number of attempts including the first one, retries are disabled if less than 2"`
+	Backoff    Duration `json:"backoff,omitempty" title:"Delay before the first retry, default 1s"`
+	MaxBackoff Duration `json:"max_backoff,omitempty" title:"Max delay between retries, default 30s"`
+	Jitter     float64  `json:"jitter,omitempty" title:"Fraction of delay to randomize, from 0 to 1"`
+}
+
+// BreakerConfig configures circuit breaker of a provider.
+//
+// Breaker opens when any of enabled thresholds is reached, and stays open for OpenFor duration.
+// Then probe requests are allowed, breaker closes after successful probes and opens again on failure.
+type BreakerConfig struct {
+	ConsecutiveFailures int      `json:"consecutive_failures,omitempty" title:"Open breaker after this many consecutive failures, 0 to disable"`
+	ErrorRate           float64  `json:"error_rate,omitempty" title:"Open breaker when error rate in window reaches this fraction, 0 to disable"`
+	Window              Duration `json:"window,omitempty" title:"Error rate window, default 1m"`
+	MinRequests         int      `json:"min_requests,omitempty" title:"Min number of requests in window to evaluate error rate, default 10"`
+	OpenFor             Duration `json:"open_for,omitempty" title:"Time to keep breaker open before probing, default 30s"`
+	Probes              int      `json:"probes,omitempty" title:"Number of successful probes to close breaker, default 1"`
+}
+
+// AdaptiveConfig configures adaptive routing strategy.
+type AdaptiveConfig struct {
+	Alpha float64 `json:"alpha,omitempty" title:"EWMA smoothing factor for latency and success rate, from 0 to 1, default 0.2"`
+	Floor float64 `json:"floor,omitempty" title:"Min share of configured weight kept for exploration, from 0 to 1, default 0.05"`
+}
+
+// Price defines model pricing in a currency of choice.
+type Price struct {
+	InputPerMillion  float64 `json:"input_per_million,omitempty" title:"Price of 1M input tokens"`
+	OutputPerMillion float64 `json:"output_per_million,omitempty" title:"Price of 1M output tokens"`
+	PerImage         float64 `json:"per_image,omitempty" title:"Price per request"`
+}
+
+// Budget limits spend per UTC day and month.
+type Budget struct {
+	Daily   float64 `json:"daily,omitempty" title:"Max spend per day, 0 for unlimited"`
+	Monthly float64 `json:"monthly,omitempty" title:"Max spend per month, 0 for unlimited"`
+}
+
+// HedgeConfig configures hedged requests to cut tail latency.
+//
+// If a request does not finish within a delay, another request is sent to a different provider,
+// the first successful result is used and the other request is canceled.
+type HedgeConfig struct {
+	Delay      Duration `json:"delay,omitempty" title:"Delay before hedged request, also used when there are not enough samples for percentile"`
+	Percentile float64  `json:"percentile,omitempty" title:"Latency percentile of provider to use as delay, e.g. 0.95"`
+	MinSamples int      `json:"min_samples,omitempty" title:"Min number of latency samples to use percentile, default 20"`
+}
+
+// AIMDConfig configures adaptive concurrency limit with additive increase and multiplicative decrease.
+//
+// Limit starts from Concurrency, grows by Increase after a window of successful requests
+// and is multiplied by Decrease on exhaustion or when latency exceeds threshold.
+type AIMDConfig struct {
+	Min              int      `json:"min,omitempty" title:"Min concurrency, default 1"`
+	Max              int      `json:"max,omitempty" title:"Max concurrency, adaptive limit is enabled when positive"`
+	Increase         float64  `json:"increase,omitempty" title:"Additive increase, default 1"`
+	Decrease         float64  `json:"decrease,omitempty" title:"Multiplicative decrease factor, from 0 to 1, default 0.5"`
+	LatencyThreshold Duration `json:"latency_threshold,omitempty" title:"Latency that is treated as overload, disabled by default"`
+}
+
+// BanditConfig configures strategies that learn from feedback.
+type BanditConfig struct {
+	PriorStrength float64 `json:"prior_strength,omitempty" title:"Number of pseudo-observations of configured weights, default 10"`
+	Exploration   float64 `json:"exploration,omitempty" title:"Exploration factor of ucb strategy, default 1"`
+	StateFile     string  `json:"state_file,omitempty" title:"Path to file to persist feedback, so that learning survives restarts"`
+}
+
+// ShadowConfig configures mirroring of requests to candidate providers.
+//
+// Shadow outputs are recorded next to primary results and are never returned to the caller.
+type ShadowConfig struct {
+	Fraction    float64    `json:"fraction,omitempty" title:"Fraction of successful requests to mirror, from 0 to 1"`
+	Concurrency int        `json:"concurrency,omitempty" title:"Max concurrent shadow requests, requests over the limit are skipped" default:"1"`
+	Providers   []Provider `json:"providers,omitempty" title:"Shadow providers, each of them receives mirrored requests"`
+	Log         string     `json:"log,omitempty" title:"Path to JSONL file to record shadow outputs next to primary results"`
+}
+
+// EnsembleConfig configures querying multiple providers in parallel and merging their captions.
+type EnsembleConfig struct {
+	Size        int      `json:"size,omitempty" title:"Number of providers to query, default 3"`
+	Merge       string   `json:"merge,omitempty" title:"Merge method: vote (default) or judge"`
+	Judge       Provider `json:"judge" title:"Provider that synthesizes final caption in judge mode"`
+	JudgePrompt string   `json:"judge_prompt,omitempty" title:"Prompt of judge, {{captions}} is replaced with numbered candidate captions"`
+	Quorum      float64  `json:"quorum,omitempty" title:"Share of candidates that must agree on a sentence in vote mode, default 0.5"`
+	Similarity  float64  `json:"similarity,omitempty" title:"Min Jaccard similarity of words to consider sentences equal in vote mode, default 0.5"`
+}
+
+// ConfidenceConfig configures re-routing of low-confidence captions.
+//
+// Confidence is reported by providers that support logprobs, results without confidence are not re-routed.
+type ConfidenceConfig struct {
+	Threshold float64  `json:"threshold,omitempty" title:"Min confidence from 0 to 1, results below it are re-routed"`
+	Names     []string `json:"names,omitempty" title:"Names of stronger providers, any other provider by default"`
+	Tags      []string `json:"tags,omitempty" title:"Tags of stronger providers, any other provider by default"`
+}
+
+// ValidationConfig configures output validation.
+//
+// Rejected outputs are retried on another provider, and prompt is picked again if it is not fixed.
+type ValidationConfig struct {
+	Refusal    bool     `json:"refusal,omitempty" title:"Reject common refusals, e.g. I'm sorry, I can't help with that"`
+	Patterns   []string `json:"patterns,omitempty" title:"Regular expressions of outputs to reject"`
+	MinLength  int      `json:"min_length,omitempty" title:"Min output length in characters"`
+	MaxLength  int      `json:"max_length,omitempty" title:"Max output length in characters"`
+	Script     string   `json:"script,omitempty" title:"Unicode script of expected language, e.g. Latin, Cyrillic or Han"`
+	PromptEcho bool     `json:"prompt_echo,omitempty" title:"Reject outputs that repeat the prompt"`
+	Retries    int      `json:"retries,omitempty" title:"Max number of retries of rejected outputs, default 2, -1 to disable"`
+}
+
+// CritiqueConfig configures review of captions against the image and the prompt rules.
+type CritiqueConfig struct {
+	Passes int      `json:"passes,omitempty" title:"Max number of review passes, 0 to disable"`
+	Names  []string `json:"names,omitempty" title:"Names of reviewer providers, provider of caption reviews it by default"`
+	Tags   []string `json:"tags,omitempty" title:"Tags of reviewer providers"`
+	Prompt string   `json:"prompt,omitempty" title:"Reviewer prompt, {{prompt}} and {{caption}} are replaced with original prompt and caption"`
+}
+
+// CacheConfig configures filesystem cache of provider responses.
+//
+// Responses are keyed by SHA-256 of the image, prompt, model and request options.
+type CacheConfig struct {
+	Dir     string   `json:"dir,omitempty" title:"Cache directory, cache is enabled when set"`
+	TTL     Duration `json:"ttl,omitempty" title:"Time to keep responses, forever by default"`
+	MaxSize int64    `json:"max_size,omitempty" title:"Max cache size in bytes, unlimited by default"`
 }
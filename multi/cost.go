@@ -0,0 +1,158 @@
+package multi
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/vearutop/image-prompt/imageprompt"
+)
+
+// cost returns request cost for token usage.
+func (p Price) cost(u imageprompt.Usage) float64 {
+	return float64(u.InputTokens)*p.InputPerMillion/1e6 + float64(u.OutputTokens)*p.OutputPerMillion/1e6 + p.PerImage
+}
+
+func (p Price) paid() bool {
+	return p.InputPerMillion > 0 || p.OutputPerMillion > 0 || p.PerImage > 0
+}
+
+// modelName returns model name of provider without resolving secrets.
+func (p Provider) modelName() string {
+	pr, err := p.prompter(nil)
+	if err != nil {
+		return p.Model
+	}
+
+	return pr.ModelName()
+}
+
+// spendTracker accumulates spend per provider by UTC day and month and persists it to a file.
+type spendTracker struct {
+	mu    sync.Mutex
+	state stateFile
+
+	Days   map[string]map[string]float64 `json:"days"`   // Day, provider ID, spend.
+	Months map[string]map[string]float64 `json:"months"` // Month, provider ID, spend.
+}
+
+func dayMonth(now time.Time) (string, string) {
+	now = now.UTC()
+
+	return now.Format(time.DateOnly), now.Format("2006-01")
+}
+
+// load reads spend file once, or again if file name is changed.
+func (t *spendTracker) load(file string) error {
+	err := t.state.load(file, t, func() {
+		t.Days = map[string]map[string]float64{}
+		t.Months = map[string]map[string]float64{}
+	})
+
+	if t.Days == nil {
+		t.Days = map[string]map[string]float64{}
+	}
+
+	if t.Months == nil {
+		t.Months = map[string]map[string]float64{}
+	}
+
+	return err
+}
+
+// spent returns day and month spend of a provider, or total spend if provider is empty.
+func (t *spendTracker) spent(file, provider string, now time.Time) (day, month float64, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	err = t.load(file)
+	d, m := dayMonth(now)
+
+	sum := func(spend map[string]float64) float64 {
+		if provider != "" {
+			return spend[provider]
+		}
+
+		total := 0.0
+		for _, v := range spend {
+			total += v
+		}
+
+		return total
+	}
+
+	return sum(t.Days[d]), sum(t.Months[m]), err
+}
+
+// add registers spend and persists it.
+func (t *spendTracker) add(file, provider string, now time.Time, cost float64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	err := t.load(file)
+	d, m := dayMonth(now)
+
+	if t.Days[d] == nil {
+		t.Days[d] = map[string]float64{}
+	}
+
+	if t.Months[m] == nil {
+		t.Months[m] = map[string]float64{}
+	}
+
+	t.Days[d][provider] += cost
+	t.Months[m][provider] += cost
+
+	// Only current day and month are needed for budgets.
+	for k := range t.Days {
+		if k != d {
+			delete(t.Days, k)
+		}
+	}
+
+	for k := range t.Months {
+		if k != m {
+			delete(t.Months, k)
+		}
+	}
+
+	return errors.Join(err, t.state.save(t))
+}
+
+// overBudget checks if provider spend reached provider budget or total spend reached total budget.
+func (ip *ImagePrompter) overBudget(cfg Config, p Provider, now time.Time) bool {
+	if p.Budget.enabled() {
+		day, month, err := ip.spend.spent(cfg.SpendFile, p.ID(), now)
+		ip.reportError(err)
+
+		if p.Budget.reached(day, month) {
+			return true
+		}
+	}
+
+	if cfg.Budget.enabled() && cfg.Prices[p.modelName()].paid() {
+		day, month, err := ip.spend.spent(cfg.SpendFile, "", now)
+		ip.reportError(err)
+
+		if cfg.Budget.reached(day, month) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (b Budget) enabled() bool {
+	return b.Daily > 0 || b.Monthly > 0
+}
+
+func (b Budget) reached(day, month float64) bool {
+	return (b.Daily > 0 && day >= b.Daily) || (b.Monthly > 0 && month >= b.Monthly)
+}
+
+// reportError passes background error to OnError hook.
+func (ip *ImagePrompter) reportError(err error) {
+	if err != nil && ip.OnError != nil {
+		ip.OnError(imageprompt.RedactError(err))
+	}
+}
@@ -0,0 +1,117 @@
+package multi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// defaultReviewPrompt is used when CritiqueConfig.Prompt is empty.
+const defaultReviewPrompt = `You are reviewing a caption of this image that was written for the instructions below.
+
+Instructions:
+{{prompt}}
+
+Caption:
+{{caption}}
+
+Check the caption against the image and the instructions. Remove or fix claims that are not visible in the image ` +
+	`or that break the instructions, for example names of places, items or people that are not certain. ` +
+	`Keep everything else unchanged.
+Reply with JSON object only: {"caption": "corrected caption", "removed": ["removed or changed claim"]}.`
+
+// Critique describes self-critique passes.
+type Critique struct {
+	Original string   `json:"original"`          // Caption before review.
+	Removed  []string `json:"removed,omitempty"` // Claims removed or changed by reviewer.
+	Passes   int      `json:"passes"`            // Number of completed review passes.
+	Reviewer string   `json:"reviewer"`          // Provider ID of reviewer.
+}
+
+func (c CritiqueConfig) enabled() bool {
+	return c.Passes > 0
+}
+
+// reviewer returns provider to review result, it is the provider of result if no reviewers are configured.
+func (ip *ImagePrompter) reviewer(cfg Config, res Result) (Provider, error) {
+	cc := cfg.Critique
+
+	if len(cc.Names) == 0 && len(cc.Tags) == 0 {
+		for _, pr := range cfg.Providers {
+			if pr.Provider.ID() == res.Provider {
+				return pr.Provider, nil
+			}
+		}
+
+		return ip.pickProvider(cfg, Routing{})
+	}
+
+	r := Routing{Names: cc.Names, Tags: cc.Tags}
+
+	return ip.pickProvider(withDedicated(cfg, r), r)
+}
+
+// critique reviews result caption against the image and prompt rules and corrects it.
+//
+// Result is returned with partial corrections if a review pass fails.
+func (ip *ImagePrompter) critique(ctx context.Context, cfg Config, res Result, img []byte) Result {
+	cc := cfg.Critique
+	if !cc.enabled() {
+		return res
+	}
+
+	provider, err := ip.reviewer(cfg, res)
+	if err != nil {
+		ip.reportError(fmt.Errorf("critique: %w", err))
+
+		return res
+	}
+
+	tpl := cc.Prompt
+	if tpl == "" {
+		tpl = defaultReviewPrompt
+	}
+
+	c := &Critique{Original: res.Text, Reviewer: provider.ID()}
+
+	for range cc.Passes {
+		prompt := strings.NewReplacer("{{prompt}}", res.Prompt, "{{caption}}", res.Text).Replace(tpl)
+
+		rr, err := ip.do(ctx, cfg, ip.prompter(prompt, "", provider), img)
+		if err != nil {
+			ip.reportError(fmt.Errorf("critique: %w", err))
+
+			break
+		}
+
+		res.Usage.InputTokens += rr.Usage.InputTokens
+		res.Usage.OutputTokens += rr.Usage.OutputTokens
+		res.Cost += rr.Cost
+
+		var review struct {
+			Caption string   `json:"caption"`
+			Removed []string `json:"removed"`
+		}
+
+		if err := json.Unmarshal(jsonObject(rr.Text), &review); err != nil || review.Caption == "" {
+			ip.reportError(fmt.Errorf("critique: unexpected review: %q", rr.Text))
+
+			break
+		}
+
+		c.Passes++
+		c.Removed = append(c.Removed, review.Removed...)
+
+		unchanged := review.Caption == res.Text
+		res.Text = review.Caption
+
+		if unchanged || len(review.Removed) == 0 {
+			break // Nothing left to fix.
+		}
+	}
+
+	res.Critique = c
+
+	return res
+}
@@ -0,0 +1,175 @@
+package multi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// reviewPrompter responds with replies in order, "error" reply fails the call.
+type reviewPrompter struct {
+	replies []string
+	prompts []string
+}
+
+func (p *reviewPrompter) PromptImage(_ context.Context, prompt string, _ io.Reader) (string, error) {
+	p.prompts = append(p.prompts, prompt)
+
+	if len(p.prompts) > len(p.replies) {
+		return "", errors.New("unexpected call")
+	}
+
+	if r := p.replies[len(p.prompts)-1]; r != "error" {
+		return r, nil
+	}
+
+	return "", errors.New("failed")
+}
+
+func (p *reviewPrompter) ModelName() string {
+	return "review"
+}
+
+func TestImagePrompter_critique(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		cfg      CritiqueConfig
+		replies  []string // Replies of reviewer.
+		text     string
+		removed  []string
+		passes   int
+		reviewer string // Empty if critique is not expected.
+	}{
+		{
+			name: "disabled",
+			text: "A dog in Paris.",
+		},
+		{
+			name:     "single pass",
+			cfg:      CritiqueConfig{Passes: 1},
+			replies:  []string{`{"caption": "A dog.", "removed": ["Paris"]}`},
+			text:     "A dog.",
+			removed:  []string{"Paris"},
+			passes:   1,
+			reviewer: "writer",
+		},
+		{
+			name: "stops when unchanged",
+			cfg:  CritiqueConfig{Passes: 3},
+			replies: []string{
+				`{"caption": "A dog near a tower.", "removed": ["Paris"]}`,
+				`{"caption": "A dog near a tower.", "removed": ["Eiffel"]}`,
+			},
+			text:     "A dog near a tower.",
+			removed:  []string{"Paris", "Eiffel"},
+			passes:   2,
+			reviewer: "writer",
+		},
+		{
+			name: "stops when nothing is removed",
+			cfg:  CritiqueConfig{Passes: 3},
+			replies: []string{
+				"```json\n{\"caption\": \"A dog.\", \"removed\": [\"Paris\"]}\n```",
+				`{"caption": "A brown dog."}`,
+			},
+			text:     "A brown dog.",
+			removed:  []string{"Paris"},
+			passes:   2,
+			reviewer: "writer",
+		},
+		{
+			name: "passes limit",
+			cfg:  CritiqueConfig{Passes: 2},
+			replies: []string{
+				`{"caption": "A dog near a tower.", "removed": ["Paris"]}`,
+				`{"caption": "A dog.", "removed": ["tower"]}`,
+			},
+			text:     "A dog.",
+			removed:  []string{"Paris", "tower"},
+			passes:   2,
+			reviewer: "writer",
+		},
+		{
+			name:     "unexpected review",
+			cfg:      CritiqueConfig{Passes: 2},
+			replies:  []string{"The caption is fine."},
+			text:     "A dog in Paris.",
+			reviewer: "writer",
+		},
+		{
+			name: "partial corrections",
+			cfg:  CritiqueConfig{Passes: 2},
+			replies: []string{
+				`{"caption": "A dog.", "removed": ["Paris"]}`,
+				"error",
+			},
+			text:     "A dog.",
+			removed:  []string{"Paris"},
+			passes:   1,
+			reviewer: "writer",
+		},
+		{
+			name:     "dedicated reviewer",
+			cfg:      CritiqueConfig{Passes: 1, Names: []string{"reviewer"}},
+			replies:  []string{`{"caption": "A dog.", "removed": ["Paris"]}`},
+			text:     "A dog.",
+			removed:  []string{"Paris"},
+			passes:   1,
+			reviewer: "reviewer",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			reviewers := map[string]*reviewPrompter{"writer": {}, "reviewer": {}}
+			if tc.reviewer != "" {
+				reviewers[tc.reviewer].replies = tc.replies
+			}
+
+			cfg := Config{
+				Prompts: []WeightedPrompt{{Prompt: "caption", Weight: 1}},
+				Providers: []WeightedProvider{
+					{Provider: Provider{Name: "writer", Prompter: reviewers["writer"]}, Weight: 1},
+					{Provider: Provider{Name: "reviewer", Prompter: reviewers["reviewer"]}},
+				},
+				Critique: tc.cfg,
+			}
+
+			ip := NewImagePrompter(func() Config { return cfg })
+
+			res := ip.critique(context.Background(), cfg, Result{Text: "A dog in Paris.", Prompt: "Do not name places.", Provider: "writer"}, nil)
+
+			if res.Text != tc.text {
+				t.Fatalf("%q expected, %q received", tc.text, res.Text)
+			}
+
+			if tc.reviewer == "" {
+				if res.Critique != nil {
+					t.Fatalf("no critique expected, %+v received", res.Critique)
+				}
+
+				return
+			}
+
+			c := res.Critique
+			if c == nil || c.Original != "A dog in Paris." || c.Passes != tc.passes || c.Reviewer != tc.reviewer ||
+				strings.Join(c.Removed, ",") != strings.Join(tc.removed, ",") {
+				t.Fatalf("unexpected critique: %+v", c)
+			}
+
+			rp := reviewers[tc.reviewer]
+			if len(rp.prompts) != len(tc.replies) {
+				t.Fatalf("%d review calls expected, %d received", len(tc.replies), len(rp.prompts))
+			}
+
+			// Each pass reviews the caption of previous pass.
+			if !strings.Contains(rp.prompts[0], "Do not name places.") || !strings.Contains(rp.prompts[0], "Caption:\nA dog in Paris.") {
+				t.Fatalf("unexpected review prompt: %s", rp.prompts[0])
+			}
+
+			if len(rp.prompts) > 1 && strings.Contains(rp.prompts[1], "A dog in Paris.") {
+				t.Fatalf("corrected caption expected in review prompt: %s", rp.prompts[1])
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package multi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+
+	"github.com/vearutop/image-prompt/imageprompt"
+)
+
+// dedupKey identifies identical requests by image hash, prompt, routing overrides and options.
+func dedupKey(ctx context.Context, prompt string, img []byte) string {
+	routing, _ := RoutingFromContext(ctx)
+	r, _ := json.Marshal(routing)                             //nolint:errchkjson // Routing is always serializable.
+	o, _ := json.Marshal(imageprompt.OptionsFromContext(ctx)) //nolint:errchkjson // Options are always serializable.
+	i := sha256.Sum256(img)
+
+	h := sha256.New()
+	h.Write(i[:])
+
+	for _, b := range [][]byte{[]byte(prompt), r, o} {
+		h.Write([]byte{0})
+		h.Write(b)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// flight is a request in progress shared by waiters.
+type flight struct {
+	done    chan struct{}
+	res     Result
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// flightGroup coalesces identical concurrent requests.
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// dedup runs fn once for concurrent requests with the same key and shares the result.
+//
+// Shared request runs with a context detached from waiters, it is canceled when all waiters are gone.
+// Each waiter can leave early when its own context is canceled.
+func (ip *ImagePrompter) dedup(ctx context.Context, key string, fn func(ctx context.Context) (Result, error)) (Result, error) {
+	g := &ip.flights
+
+	g.mu.Lock()
+
+	if g.flights == nil {
+		g.flights = map[string]*flight{}
+	}
+
+	f, shared := g.flights[key]
+	if !shared {
+		fctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		f = &flight{done: make(chan struct{}), cancel: cancel}
+		g.flights[key] = f
+
+		go func() {
+			defer cancel()
+
+			f.res, f.err = fn(fctx)
+
+			g.mu.Lock()
+			if g.flights[key] == f {
+				delete(g.flights, key)
+			}
+			g.mu.Unlock()
+
+			close(f.done)
+		}()
+	}
+
+	f.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-f.done:
+		res := f.res
+		res.Shared = shared
+
+		return res, f.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		f.waiters--
+
+		if f.waiters == 0 {
+			f.cancel()
+
+			// New requests should not join canceled flight.
+			if g.flights[key] == f {
+				delete(g.flights, key)
+			}
+		}
+
+		g.mu.Unlock()
+
+		return Result{}, ctx.Err()
+	}
+}
@@ -0,0 +1,187 @@
+package multi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingPrompter counts calls and responds when released.
+type blockingPrompter struct {
+	calls   atomic.Int64
+	release chan struct{}
+}
+
+func (b *blockingPrompter) PromptImage(ctx context.Context, _ string, _ io.Reader) (string, error) {
+	b.calls.Add(1)
+
+	select {
+	case <-b.release:
+		return "caption", nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func (b *blockingPrompter) ModelName() string {
+	return "blocking"
+}
+
+func newDedupPrompter(t *testing.T) (*ImagePrompter, *blockingPrompter) {
+	t.Helper()
+
+	bp := &blockingPrompter{release: make(chan struct{})}
+	cfg := Config{
+		Prompts:   []WeightedPrompt{{Prompt: "caption", Weight: 1}},
+		Providers: []WeightedProvider{{Provider: Provider{Prompter: bp}, Weight: 1}},
+		Dedup:     true,
+	}
+
+	return NewImagePrompter(func() Config { return cfg }), bp
+}
+
+// waitWaiters waits until a single flight has n waiters.
+func waitWaiters(t *testing.T, ip *ImagePrompter, n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for time.Now().Before(deadline) {
+		ip.flights.mu.Lock()
+		waiters := 0
+
+		for _, f := range ip.flights.flights {
+			waiters += f.waiters
+		}
+
+		ip.flights.mu.Unlock()
+
+		if waiters == n {
+			return
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Fatalf("%d waiters expected", n)
+}
+
+func TestImagePrompter_dedup_shared(t *testing.T) {
+	const n = 5
+
+	ip, bp := newDedupPrompter(t)
+
+	var (
+		wg      sync.WaitGroup
+		results = make([]Result, n)
+		errs    = make([]error, n)
+	)
+
+	for i := range n {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			results[i], errs[i] = ip.PromptImageResult(context.Background(), "", bytes.NewReader([]byte("img")))
+		}()
+	}
+
+	waitWaiters(t, ip, n)
+	close(bp.release)
+	wg.Wait()
+
+	if c := bp.calls.Load(); c != 1 {
+		t.Fatalf("single provider call expected, %d received", c)
+	}
+
+	ids := map[string]bool{}
+	shared := 0
+
+	for i, res := range results {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+
+		if res.Text != "caption" {
+			t.Fatalf("unexpected text %q", res.Text)
+		}
+
+		if res.Shared {
+			shared++
+		}
+
+		ids[res.ID] = true
+
+		if err := ip.ReportFeedback(res.ID, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if shared != n-1 {
+		t.Fatalf("%d shared results expected, %d received", n-1, shared)
+	}
+
+	if len(ids) != n {
+		t.Fatalf("%d distinct result IDs expected, %d received", n, len(ids))
+	}
+}
+
+func TestImagePrompter_dedup_cancel(t *testing.T) {
+	ip, bp := newDedupPrompter(t)
+
+	var (
+		wg          sync.WaitGroup
+		ctx, cancel = context.WithCancel(context.Background())
+		canceledErr error
+		results     = make([]Result, 2)
+		errs        = make([]error, 2)
+	)
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		_, canceledErr = ip.PromptImageResult(ctx, "", bytes.NewReader([]byte("img")))
+	}()
+
+	for i := range 2 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			results[i], errs[i] = ip.PromptImageResult(context.Background(), "", bytes.NewReader([]byte("img")))
+		}()
+	}
+
+	waitWaiters(t, ip, 3)
+	cancel()
+	waitWaiters(t, ip, 2)
+	close(bp.release)
+	wg.Wait()
+
+	if !errors.Is(canceledErr, context.Canceled) {
+		t.Fatalf("canceled error expected, %v received", canceledErr)
+	}
+
+	for i, res := range results {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+
+		if res.Text != "caption" {
+			t.Fatalf("unexpected text %q", res.Text)
+		}
+	}
+
+	if c := bp.calls.Load(); c != 1 {
+		t.Fatalf("single provider call expected, %d received", c)
+	}
+}
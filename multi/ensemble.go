@@ -0,0 +1,304 @@
+package multi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Ensemble merge methods.
+const (
+	MergeVote  = "vote"  // Majority vote of sentences shared by candidates, default.
+	MergeJudge = "judge" // Judge provider synthesizes final caption from candidates.
+)
+
+// defaultJudgePrompt is used when EnsembleConfig.JudgePrompt is empty.
+const defaultJudgePrompt = `Here are captions of this image written by different models:
+
+{{captions}}
+
+Write a single caption of the image that keeps the facts the captions agree on and that are visible in the image, ` +
+	`and drops the claims that are not supported.
+Reply with JSON object only: {"caption": "final caption", "rationale": "which claims were kept or dropped and why"}.`
+
+func (c EnsembleConfig) withDefaults() EnsembleConfig {
+	if c.Size <= 0 {
+		c.Size = 3
+	}
+
+	if c.Merge == "" {
+		c.Merge = MergeVote
+	}
+
+	if c.JudgePrompt == "" {
+		c.JudgePrompt = defaultJudgePrompt
+	}
+
+	if c.Quorum <= 0 || c.Quorum > 1 {
+		c.Quorum = 0.5
+	}
+
+	if c.Similarity <= 0 || c.Similarity > 1 {
+		c.Similarity = 0.5
+	}
+
+	return c
+}
+
+// ensemble queries multiple providers in parallel and merges their results.
+func (ip *ImagePrompter) ensemble(ctx context.Context, cfg Config, pr prompter, routing Routing, img []byte) (Result, error) {
+	ec := cfg.Ensemble.withDefaults()
+
+	if ec.Merge == MergeJudge && ec.Judge.Type == "" && ec.Judge.Prompter == nil {
+		return Result{}, errors.New("ensemble judge provider is not configured")
+	}
+
+	first, err := ip.withProvider(cfg, pr, routing)
+	if err != nil {
+		return Result{}, err
+	}
+
+	prompters := []prompter{first}
+	routing.Exclude = append(slices.Clone(routing.Exclude), first.p.ID())
+
+	for len(prompters) < ec.Size {
+		provider, err := ip.pickProvider(cfg, routing)
+		if err != nil {
+			break // Using available providers.
+		}
+
+		prompters = append(prompters, ip.prompter(first.prompt, first.promptName, provider))
+		routing.Exclude = append(routing.Exclude, provider.ID())
+	}
+
+	results := make([]Result, len(prompters))
+	errs := make([]error, len(prompters))
+
+	var wg sync.WaitGroup
+
+	for i, p := range prompters {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			results[i], errs[i] = ip.do(ctx, cfg, p, img)
+		}()
+	}
+
+	wg.Wait()
+
+	var candidates []Result
+
+	for i, res := range results {
+		if errs[i] == nil {
+			candidates = append(candidates, res)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return Result{}, errors.Join(errs...)
+	}
+
+	res := Result{
+		Prompt:     first.prompt,
+		PromptName: first.promptName,
+		Candidates: candidates,
+	}
+
+	for _, c := range candidates {
+		res.Usage.InputTokens += c.Usage.InputTokens
+		res.Usage.OutputTokens += c.Usage.OutputTokens
+		res.Cost += c.Cost
+	}
+
+	if ec.Merge == MergeJudge {
+		return ip.judge(ctx, cfg, ec, res, img)
+	}
+
+	return vote(ec, res), nil
+}
+
+// judge asks judge provider to synthesize final caption from candidates.
+func (ip *ImagePrompter) judge(ctx context.Context, cfg Config, ec EnsembleConfig, res Result, img []byte) (Result, error) {
+	captions := make([]string, 0, len(res.Candidates))
+	for i, c := range res.Candidates {
+		captions = append(captions, strconv.Itoa(i+1)+". "+c.Text)
+	}
+
+	prompt := ec.JudgePrompt
+	if strings.Contains(prompt, "{{captions}}") {
+		prompt = strings.ReplaceAll(prompt, "{{captions}}", strings.Join(captions, "\n\n"))
+	} else {
+		prompt += "\n\n" + strings.Join(captions, "\n\n")
+	}
+
+	jr, err := ip.do(ctx, cfg, ip.prompter(prompt, "", ec.Judge), img)
+	if err != nil {
+		return Result{}, fmt.Errorf("ensemble judge: %w", err)
+	}
+
+	res.Text = jr.Text
+	res.Provider = jr.Provider
+	res.Model = jr.Model
+	res.KeyIndex = jr.KeyIndex
+	res.Usage.InputTokens += jr.Usage.InputTokens
+	res.Usage.OutputTokens += jr.Usage.OutputTokens
+	res.Cost += jr.Cost
+
+	var verdict struct {
+		Caption   string `json:"caption"`
+		Rationale string `json:"rationale"`
+	}
+
+	if err := json.Unmarshal(jsonObject(jr.Text), &verdict); err == nil && verdict.Caption != "" {
+		res.Text = verdict.Caption
+		res.Rationale = verdict.Rationale
+	}
+
+	return res, nil
+}
+
+// jsonObject extracts JSON object from LLM reply, models often wrap JSON in a code block.
+func jsonObject(text string) []byte {
+	if i, j := strings.Index(text, "{"), strings.LastIndex(text, "}"); i >= 0 && j > i {
+		text = text[i : j+1]
+	}
+
+	return []byte(text)
+}
+
+// vote keeps sentences that are shared by a quorum of candidates.
+//
+// Sentences are compared by Jaccard similarity of their words.
+func vote(ec EnsembleConfig, res Result) Result {
+	type sentence struct {
+		text  string
+		words map[string]bool
+	}
+
+	candidates := make([][]sentence, len(res.Candidates))
+
+	for i, c := range res.Candidates {
+		for _, s := range splitSentences(c.Text) {
+			candidates[i] = append(candidates[i], sentence{text: s, words: words(s)})
+		}
+	}
+
+	var (
+		kept      []sentence
+		rationale []string
+		n         = len(candidates)
+		best      string
+		bestVotes = 0
+	)
+
+	for i, ss := range candidates {
+		for _, s := range ss {
+			if slices.ContainsFunc(kept, func(k sentence) bool { return jaccard(k.words, s.words) >= ec.Similarity }) {
+				continue
+			}
+
+			votes := 1
+
+			for j, other := range candidates {
+				if j != i && slices.ContainsFunc(other, func(o sentence) bool { return jaccard(o.words, s.words) >= ec.Similarity }) {
+					votes++
+				}
+			}
+
+			if votes > bestVotes {
+				best, bestVotes = s.text, votes
+			}
+
+			if float64(votes)/float64(n) >= ec.Quorum {
+				kept = append(kept, s)
+				rationale = append(rationale, fmt.Sprintf("kept (%d/%d): %s", votes, n, s.text))
+			} else {
+				rationale = append(rationale, fmt.Sprintf("dropped (%d/%d): %s", votes, n, s.text))
+			}
+		}
+	}
+
+	texts := make([]string, 0, len(kept))
+	for _, k := range kept {
+		texts = append(texts, k.text)
+	}
+
+	res.Text = strings.Join(texts, " ")
+
+	if res.Text == "" {
+		res.Text = best
+
+		rationale = append(rationale, "no sentence reached quorum, the most supported one is used")
+	}
+
+	models := make([]string, 0, n)
+	for _, c := range res.Candidates {
+		models = append(models, c.Model)
+	}
+
+	res.Model = "ensemble(" + strings.Join(models, ",") + ")"
+	res.Rationale = strings.Join(rationale, "\n")
+
+	return res
+}
+
+// splitSentences splits text by sentence terminators followed by space.
+func splitSentences(text string) []string {
+	var (
+		res   []string
+		start = 0
+		runes = []rune(text)
+	)
+
+	for i, r := range runes {
+		if (r == '.' || r == '!' || r == '?') && (i == len(runes)-1 || unicode.IsSpace(runes[i+1])) {
+			if s := strings.TrimSpace(string(runes[start : i+1])); s != "" {
+				res = append(res, s)
+			}
+
+			start = i + 1
+		}
+	}
+
+	if s := strings.TrimSpace(string(runes[start:])); s != "" {
+		res = append(res, s)
+	}
+
+	return res
+}
+
+func words(s string) map[string]bool {
+	res := map[string]bool{}
+
+	for _, w := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		res[w] = true
+	}
+
+	return res
+}
+
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+
+	common := 0
+
+	for w := range a {
+		if b[w] {
+			common++
+		}
+	}
+
+	return float64(common) / float64(len(a)+len(b)-common)
+}
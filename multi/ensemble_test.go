@@ -0,0 +1,118 @@
+package multi
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitSentences(t *testing.T) {
+	for _, tc := range []struct {
+		text string
+		want []string
+	}{
+		{text: "", want: nil},
+		{text: "A dog", want: []string{"A dog"}},
+		{text: "A dog. A cat!  Is it a bird?", want: []string{"A dog.", "A cat!", "Is it a bird?"}},
+		{text: "Version 1.5 of a dog.\nA cat", want: []string{"Version 1.5 of a dog.", "A cat"}},
+		{text: "Wait... A dog.", want: []string{"Wait...", "A dog."}},
+		{text: " . A dog.", want: []string{".", "A dog."}},
+		{text: "Собака. Кот.", want: []string{"Собака.", "Кот."}},
+	} {
+		t.Run(tc.text, func(t *testing.T) {
+			got := splitSentences(tc.text)
+			if strings.Join(got, "|") != strings.Join(tc.want, "|") || len(got) != len(tc.want) {
+				t.Fatalf("%q expected, %q received", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestJaccard(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want float64
+	}{
+		{a: "", b: "", want: 1},
+		{a: "A dog.", b: "", want: 0},
+		{a: "A dog.", b: "a DOG", want: 1},
+		{a: "A brown dog.", b: "A black dog.", want: 0.5},
+		{a: "A dog", b: "A cat", want: 1.0 / 3},
+		{a: "Two dogs, 2 cats", b: "two dogs", want: 0.5},
+	} {
+		t.Run(tc.a+" "+tc.b, func(t *testing.T) {
+			if got := jaccard(words(tc.a), words(tc.b)); got != tc.want {
+				t.Fatalf("%v expected, %v received", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestVote(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		ec         EnsembleConfig
+		candidates []string
+		text       string
+		rationale  []string // Expected parts of rationale.
+	}{
+		{
+			name:       "majority",
+			candidates: []string{"A dog on a beach. The sky is blue.", "A dog on the beach. A red ball.", "A cat on a sofa."},
+			text:       "A dog on a beach.",
+			rationale:  []string{"kept (2/3): A dog on a beach.", "dropped (1/3): The sky is blue.", "dropped (1/3): A cat on a sofa."},
+		},
+		{
+			name:       "similar sentences are kept once",
+			candidates: []string{"A dog on a beach.", "A dog on the beach.", "A dog on a sandy beach."},
+			text:       "A dog on a beach.",
+			rationale:  []string{"kept (3/3): A dog on a beach."},
+		},
+		{
+			name:       "order of first candidate",
+			candidates: []string{"Sunset. A dog runs.", "A dog runs. Sunset."},
+			text:       "Sunset. A dog runs.",
+		},
+		{
+			name:       "no quorum",
+			ec:         EnsembleConfig{Quorum: 1},
+			candidates: []string{"A dog on a beach. A ball.", "A dog on the beach.", "A cat."},
+			text:       "A dog on a beach.",
+			rationale:  []string{"dropped (2/3): A dog on a beach.", "no sentence reached quorum, the most supported one is used"},
+		},
+		{
+			name:       "strict similarity",
+			ec:         EnsembleConfig{Similarity: 1},
+			candidates: []string{"A dog on a beach.", "A dog on the beach.", "a dog on a beach"},
+			text:       "A dog on a beach.",
+			rationale:  []string{"kept (2/3): A dog on a beach.", "dropped (1/3): A dog on the beach."},
+		},
+		{
+			name:       "single candidate",
+			candidates: []string{"A dog. A ball."},
+			text:       "A dog. A ball.",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res := Result{}
+			for _, c := range tc.candidates {
+				res.Candidates = append(res.Candidates, Result{Text: c, Model: "m"})
+			}
+
+			res = vote(tc.ec.withDefaults(), res)
+
+			if res.Text != tc.text {
+				t.Fatalf("%q expected, %q received", tc.text, res.Text)
+			}
+
+			for _, r := range tc.rationale {
+				if !strings.Contains(res.Rationale, r) {
+					t.Fatalf("rationale %q expected in:\n%s", r, res.Rationale)
+				}
+			}
+
+			if want := "ensemble(m" + strings.Repeat(",m", len(tc.candidates)-1) + ")"; res.Model != want {
+				t.Fatalf("%s expected, %s received", want, res.Model)
+			}
+		})
+	}
+}
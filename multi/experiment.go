@@ -0,0 +1,270 @@
+package multi
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ExperimentRecord is a line of experiment log.
+//
+// Result records are written when a result is returned, feedback records only have ID, Time and Feedback.
+type ExperimentRecord struct {
+	ID           string        `json:"id"`
+	Time         time.Time     `json:"time"`
+	PromptName   string        `json:"prompt_name,omitempty"`
+	Provider     string        `json:"provider,omitempty"`
+	Model        string        `json:"model,omitempty"`
+	Latency      time.Duration `json:"latency,omitempty"`
+	InputTokens  int           `json:"input_tokens,omitempty"`
+	OutputTokens int           `json:"output_tokens,omitempty"`
+	Length       int           `json:"length,omitempty"` // Length of result text in characters.
+	Feedback     *float64      `json:"feedback,omitempty"`
+
+	feedbackOnly bool // Feedback without result line.
+}
+
+// jsonlLog appends records to a JSONL file.
+type jsonlLog struct {
+	mu sync.Mutex
+}
+
+func (l *jsonlLog) write(file string, v any) error {
+	if file == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600) //nolint:gosec // File name is provided by the user.
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		_ = f.Close()
+
+		return err
+	}
+
+	return f.Close()
+}
+
+func (ip *ImagePrompter) logResult(cfg Config, res Result) {
+	ip.reportError(ip.experiments.write(cfg.ExperimentLog, ExperimentRecord{
+		ID:           res.ID,
+		Time:         time.Now().UTC(),
+		PromptName:   res.PromptName,
+		Provider:     res.Provider,
+		Model:        res.Model,
+		Latency:      res.Latency,
+		InputTokens:  res.Usage.InputTokens,
+		OutputTokens: res.Usage.OutputTokens,
+		Length:       len([]rune(res.Text)),
+	}))
+}
+
+func (ip *ImagePrompter) logFeedback(cfg Config, id string, score float64) {
+	ip.reportError(ip.experiments.write(cfg.ExperimentLog, ExperimentRecord{
+		ID:       id,
+		Time:     time.Now().UTC(),
+		Feedback: &score,
+	}))
+}
+
+// ReadExperimentLog reads results from experiment log file with feedback merged into them.
+func ReadExperimentLog(fn string) ([]ExperimentRecord, error) {
+	f, err := os.Open(fn) //nolint:gosec // File name is provided by the user.
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var (
+		records []ExperimentRecord
+		byID    = map[string]int{}
+		s       = bufio.NewScanner(f)
+	)
+
+	s.Buffer(nil, 1<<20)
+
+	for s.Scan() {
+		if len(s.Bytes()) == 0 {
+			continue
+		}
+
+		var r ExperimentRecord
+		if err := json.Unmarshal(s.Bytes(), &r); err != nil {
+			return nil, err
+		}
+
+		// Result lines never have feedback.
+		r.feedbackOnly = r.Feedback != nil
+
+		i, ok := byID[r.ID]
+		if !ok {
+			byID[r.ID] = len(records)
+			records = append(records, r)
+
+			continue
+		}
+
+		switch {
+		case r.feedbackOnly:
+			records[i].Feedback = r.Feedback
+		case records[i].feedbackOnly:
+			// Result line after its feedback.
+			r.Feedback = records[i].Feedback
+			records[i] = r
+		}
+	}
+
+	return records, s.Err()
+}
+
+// findResult looks up a result without feedback in experiment log.
+func findResult(fn, id string) (pendingResult, bool, error) {
+	if fn == "" {
+		return pendingResult{}, false, nil
+	}
+
+	records, err := ReadExperimentLog(fn)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return pendingResult{}, false, nil
+		}
+
+		return pendingResult{}, false, err
+	}
+
+	for _, r := range records {
+		if r.ID == id && r.Feedback == nil {
+			return pendingResult{promptName: r.PromptName, provider: r.Provider}, true, nil
+		}
+	}
+
+	return pendingResult{}, false, nil
+}
+
+// VariantStats compares results of a prompt variant.
+type VariantStats struct {
+	PromptName  string        `json:"prompt_name"` // Empty for caller-supplied prompts.
+	Results     int           `json:"results"`
+	Feedback    int           `json:"feedback"` // Number of results with feedback.
+	MeanScore   float64       `json:"mean_score"`
+	CILow       float64       `json:"ci_low"`  // Lower bound of 95% confidence interval of mean score.
+	CIHigh      float64       `json:"ci_high"` // Upper bound of 95% confidence interval of mean score.
+	MeanLatency time.Duration `json:"mean_latency"`
+	MeanTokens  float64       `json:"mean_tokens"` // Mean number of output tokens.
+	MeanLength  float64       `json:"mean_length"`
+}
+
+// CompareVariants aggregates experiment records by prompt name, best mean score first.
+//
+// Confidence interval uses normal approximation and is empty with less than two feedback records.
+func CompareVariants(records []ExperimentRecord) []VariantStats {
+	type acc struct {
+		VariantStats
+
+		latency time.Duration
+		tokens  int
+		length  int
+		scores  []float64
+	}
+
+	byName := map[string]*acc{}
+
+	for _, r := range records {
+		if r.feedbackOnly {
+			continue
+		}
+
+		a := byName[r.PromptName]
+		if a == nil {
+			a = &acc{}
+			a.PromptName = r.PromptName
+			byName[r.PromptName] = a
+		}
+
+		a.Results++
+		a.latency += r.Latency
+		a.tokens += r.OutputTokens
+		a.length += r.Length
+
+		if r.Feedback != nil {
+			a.scores = append(a.scores, *r.Feedback)
+		}
+	}
+
+	res := make([]VariantStats, 0, len(byName))
+
+	for _, a := range byName {
+		v := a.VariantStats
+		n := float64(v.Results)
+
+		v.MeanLatency = a.latency / time.Duration(v.Results)
+		v.MeanTokens = float64(a.tokens) / n
+		v.MeanLength = float64(a.length) / n
+		v.Feedback = len(a.scores)
+
+		if v.Feedback > 0 {
+			sum := 0.0
+			for _, s := range a.scores {
+				sum += s
+			}
+
+			v.MeanScore = sum / float64(v.Feedback)
+			v.CILow, v.CIHigh = v.MeanScore, v.MeanScore
+
+			if v.Feedback > 1 {
+				variance := 0.0
+				for _, s := range a.scores {
+					variance += (s - v.MeanScore) * (s - v.MeanScore)
+				}
+
+				variance /= float64(v.Feedback - 1)
+				margin := 1.96 * math.Sqrt(variance/float64(v.Feedback))
+
+				v.CILow, v.CIHigh = v.MeanScore-margin, v.MeanScore+margin
+			}
+		}
+
+		res = append(res, v)
+	}
+
+	slices.SortFunc(res, func(a, b VariantStats) int {
+		if a.MeanScore != b.MeanScore {
+			if a.MeanScore > b.MeanScore {
+				return -1
+			}
+
+			return 1
+		}
+
+		if a.PromptName < b.PromptName {
+			return -1
+		}
+
+		if a.PromptName > b.PromptName {
+			return 1
+		}
+
+		return 0
+	})
+
+	return res
+}
@@ -0,0 +1,75 @@
+package multi
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompareVariants(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		lines    []string
+		results  int
+		feedback int
+	}{
+		{
+			name: "result with feedback",
+			lines: []string{
+				`{"id":"1","prompt_name":"p","provider":"a"}`,
+				`{"id":"1","feedback":1}`,
+			},
+			results:  1,
+			feedback: 1,
+		},
+		{
+			name: "voted result with feedback",
+			lines: []string{
+				`{"id":"1","prompt_name":"p","model":"ensemble(a,b)"}`,
+				`{"id":"1","feedback":1}`,
+			},
+			results:  1,
+			feedback: 1,
+		},
+		{
+			name: "orphan feedback",
+			lines: []string{
+				`{"id":"1","prompt_name":"p","provider":"a"}`,
+				`{"id":"2","feedback":0}`,
+			},
+			results: 1,
+		},
+		{
+			name: "feedback before result",
+			lines: []string{
+				`{"id":"1","feedback":0.5}`,
+				`{"id":"1","prompt_name":"p","provider":"a"}`,
+			},
+			results:  1,
+			feedback: 1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fn := filepath.Join(t.TempDir(), "experiments.jsonl")
+
+			if err := os.WriteFile(fn, []byte(strings.Join(tc.lines, "\n")), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			records, err := ReadExperimentLog(fn)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			variants := CompareVariants(records)
+			if len(variants) != 1 {
+				t.Fatalf("single variant expected, %+v received", variants)
+			}
+
+			if v := variants[0]; v.PromptName != "p" || v.Results != tc.results || v.Feedback != tc.feedback {
+				t.Fatalf("unexpected variant stats %+v", v)
+			}
+		})
+	}
+}
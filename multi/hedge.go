@@ -0,0 +1,98 @@
+package multi
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+func (c HedgeConfig) enabled() bool {
+	return c.Delay > 0 || c.Percentile > 0
+}
+
+// hedgeDelay returns delay before a hedged request, or 0 if hedging is not applicable.
+func (ip *ImagePrompter) hedgeDelay(cfg HedgeConfig, providerID string) time.Duration {
+	if cfg.Percentile > 0 && cfg.Percentile < 1 {
+		minSamples := cfg.MinSamples
+		if minSamples <= 0 {
+			minSamples = 20
+		}
+
+		if d := ip.stats(providerID).percentile(cfg.Percentile, minSamples); d > 0 {
+			return d
+		}
+	}
+
+	return time.Duration(cfg.Delay)
+}
+
+type attempt struct {
+	res Result
+	err error
+}
+
+// hedged sends request to a provider, and if it does not finish in time,
+// sends another request to a different provider and takes the first successful result.
+//
+// Slower request is canceled.
+func (ip *ImagePrompter) hedged(ctx context.Context, cfg Config, p prompter, routing Routing, img []byte) (Result, error) {
+	var delay time.Duration
+	if cfg.Hedge.enabled() {
+		delay = ip.hedgeDelay(cfg.Hedge, p.p.ID())
+	}
+
+	if delay <= 0 {
+		return ip.do(ctx, cfg, p, img)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan attempt, 2)
+
+	run := func(p prompter) {
+		res, err := ip.do(ctx, cfg, p, img)
+		results <- attempt{res: res, err: err}
+	}
+
+	go run(p)
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+
+	select {
+	case a := <-results:
+		return a.res, a.err
+	case <-ctx.Done():
+		return Result{}, ctx.Err()
+	case <-t.C:
+	}
+
+	routing.Exclude = append(slices.Clone(routing.Exclude), p.p.ID())
+
+	provider, err := ip.pickProvider(cfg, routing)
+	if err != nil {
+		// No other provider available, waiting for the first request.
+		a := <-results
+
+		return a.res, a.err
+	}
+
+	go run(ip.prompter(p.prompt, p.promptName, provider))
+
+	first := <-results
+	if first.err == nil {
+		first.res.Hedged = true
+
+		return first.res, nil
+	}
+
+	second := <-results
+	if second.err == nil {
+		second.res.Hedged = true
+
+		return second.res, nil
+	}
+
+	return first.res, first.err
+}
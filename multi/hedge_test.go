@@ -0,0 +1,116 @@
+package multi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// delayPrompter responds after a delay.
+type delayPrompter struct {
+	delay time.Duration
+	err   error
+}
+
+func (d delayPrompter) PromptImage(ctx context.Context, _ string, _ io.Reader) (string, error) {
+	select {
+	case <-time.After(d.delay):
+		return "caption", d.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func (d delayPrompter) ModelName() string {
+	return "delay"
+}
+
+func TestImagePrompter_hedged(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		hedge    HedgeConfig
+		primary  delayPrompter
+		backup   *delayPrompter
+		provider string
+		hedged   bool
+		err      bool
+	}{
+		{
+			name:     "fast primary",
+			hedge:    HedgeConfig{Delay: Duration(100 * time.Millisecond)},
+			backup:   &delayPrompter{},
+			provider: "primary",
+		},
+		{
+			name:     "slow primary",
+			hedge:    HedgeConfig{Delay: Duration(20 * time.Millisecond)},
+			primary:  delayPrompter{delay: 5 * time.Second},
+			backup:   &delayPrompter{},
+			provider: "backup",
+			hedged:   true,
+		},
+		{
+			name:     "failed backup",
+			hedge:    HedgeConfig{Delay: Duration(20 * time.Millisecond)},
+			primary:  delayPrompter{delay: 100 * time.Millisecond},
+			backup:   &delayPrompter{err: errors.New("failed")},
+			provider: "primary",
+			hedged:   true,
+		},
+		{
+			name:    "both failed",
+			hedge:   HedgeConfig{Delay: Duration(20 * time.Millisecond)},
+			primary: delayPrompter{delay: 100 * time.Millisecond, err: errors.New("failed")},
+			backup:  &delayPrompter{err: errors.New("failed")},
+			err:     true,
+		},
+		{
+			name:     "no backup",
+			hedge:    HedgeConfig{Delay: Duration(20 * time.Millisecond)},
+			primary:  delayPrompter{delay: 100 * time.Millisecond},
+			provider: "primary",
+		},
+		{
+			name:     "disabled",
+			primary:  delayPrompter{delay: 100 * time.Millisecond},
+			backup:   &delayPrompter{},
+			provider: "primary",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			primary := Provider{Name: "primary", Prompter: tc.primary}
+			cfg := Config{
+				Prompts:   []WeightedPrompt{{Prompt: "caption", Weight: 1}},
+				Providers: []WeightedProvider{{Provider: primary, Weight: 1}},
+				Hedge:     tc.hedge,
+			}
+
+			if tc.backup != nil {
+				cfg.Providers = append(cfg.Providers, WeightedProvider{
+					Provider: Provider{Name: "backup", Prompter: *tc.backup}, Weight: 1,
+				})
+			}
+
+			ip := NewImagePrompter(func() Config { return cfg })
+
+			res, err := ip.hedged(context.Background(), cfg, ip.prompter("caption", "", primary), Routing{}, nil)
+			if tc.err {
+				if err == nil {
+					t.Fatal("error expected")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if res.Provider != tc.provider || res.Hedged != tc.hedged {
+				t.Fatalf("%s (hedged %v) expected, %s (hedged %v) received", tc.provider, tc.hedged, res.Provider, res.Hedged)
+			}
+		})
+	}
+}
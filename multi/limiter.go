@@ -0,0 +1,172 @@
+package multi
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/vearutop/image-prompt/imageprompt"
+)
+
+func (c AIMDConfig) enabled() bool {
+	return c.Max > 0
+}
+
+func (c AIMDConfig) withDefaults() AIMDConfig {
+	if c.Min <= 0 {
+		c.Min = 1
+	}
+
+	if c.Max < c.Min {
+		c.Max = c.Min
+	}
+
+	if c.Increase <= 0 {
+		c.Increase = 1
+	}
+
+	if c.Decrease <= 0 || c.Decrease >= 1 {
+		c.Decrease = 0.5
+	}
+
+	return c
+}
+
+// limiter limits concurrency of provider requests.
+//
+// Limit is either fixed or adjusted with additive increase and multiplicative decrease (AIMD).
+type limiter struct {
+	mu       sync.Mutex
+	limit    float64
+	inFlight int
+	changed  chan struct{}
+
+	fixed int
+	aimd  AIMDConfig
+}
+
+func newLimiter() *limiter {
+	return &limiter{changed: make(chan struct{})}
+}
+
+// configure applies concurrency settings, in-flight requests are kept.
+func (l *limiter) configure(concurrency int, aimd AIMDConfig) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if aimd.enabled() {
+		aimd = aimd.withDefaults()
+
+		if !l.aimd.enabled() || l.aimd != aimd {
+			l.limit = min(max(float64(concurrency), float64(aimd.Min)), float64(aimd.Max))
+		}
+
+		l.aimd = aimd
+		l.fixed = 0
+	} else if l.aimd.enabled() || l.fixed != concurrency {
+		l.aimd = AIMDConfig{}
+		l.fixed = concurrency
+		l.limit = float64(concurrency)
+	} else {
+		return
+	}
+
+	l.broadcast()
+}
+
+func (l *limiter) broadcast() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// acquire waits for a free slot.
+func (l *limiter) acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+
+		if l.inFlight < max(1, int(l.limit)) {
+			l.inFlight++
+			l.mu.Unlock()
+
+			return nil
+		}
+
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// tryAcquire takes a free slot without waiting.
+func (l *limiter) tryAcquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.inFlight < max(1, int(l.limit)) {
+		l.inFlight++
+
+		return true
+	}
+
+	return false
+}
+
+// release frees a slot and adjusts adaptive limit with request outcome.
+func (l *limiter) release(latency time.Duration, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inFlight--
+
+	if l.aimd.enabled() {
+		switch {
+		case errors.Is(err, imageprompt.ErrResourceExhausted),
+			l.aimd.LatencyThreshold > 0 && latency > time.Duration(l.aimd.LatencyThreshold):
+			l.limit = max(float64(l.aimd.Min), l.limit*l.aimd.Decrease)
+		case err == nil:
+			// Limit grows by Increase after a full window of successful requests.
+			l.limit = min(float64(l.aimd.Max), l.limit+l.aimd.Increase/l.limit)
+		}
+	}
+
+	l.broadcast()
+}
+
+func (l *limiter) currentLimit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return max(1, int(l.limit))
+}
+
+func (ip *ImagePrompter) limiter(id string, p Provider) *limiter {
+	l, _ := ip.limiters.LoadOrStore(id, newLimiter())
+
+	concurrency := p.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	l.configure(concurrency, p.AdaptiveConcurrency)
+
+	return l
+}
+
+// ConcurrencyLimits returns current concurrency limits by provider ID, IDs of shadow providers have "shadow:" prefix.
+func (ip *ImagePrompter) ConcurrencyLimits() map[string]int {
+	res := map[string]int{}
+
+	ip.limiters.Range(func(id string, l *limiter) bool {
+		res[id] = l.currentLimit()
+
+		return true
+	})
+
+	return res
+}
@@ -0,0 +1,127 @@
+package multi
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vearutop/image-prompt/imageprompt"
+)
+
+func TestLimiter_release(t *testing.T) {
+	type outcome struct {
+		latency time.Duration
+		err     error
+	}
+
+	var (
+		ok        = outcome{}
+		exhausted = outcome{err: imageprompt.ErrResourceExhausted}
+		slow      = outcome{latency: 2 * time.Second}
+		failed    = outcome{err: errors.New("failed")}
+	)
+
+	for _, tc := range []struct {
+		name        string
+		concurrency int
+		aimd        AIMDConfig
+		outcomes    []outcome
+		limit       int
+	}{
+		{name: "increase", concurrency: 2, aimd: AIMDConfig{Max: 4}, outcomes: []outcome{ok, ok, ok}, limit: 3},
+		{name: "increase to max", concurrency: 3, aimd: AIMDConfig{Max: 4}, outcomes: []outcome{ok, ok, ok, ok, ok, ok}, limit: 4},
+		{name: "exhausted", concurrency: 4, aimd: AIMDConfig{Max: 8}, outcomes: []outcome{exhausted}, limit: 2},
+		{name: "custom decrease", concurrency: 4, aimd: AIMDConfig{Max: 8, Decrease: 0.75}, outcomes: []outcome{exhausted}, limit: 3},
+		{name: "slow", concurrency: 4, aimd: AIMDConfig{Max: 8, LatencyThreshold: Duration(time.Second)}, outcomes: []outcome{slow}, limit: 2},
+		{name: "decrease to min", concurrency: 4, aimd: AIMDConfig{Min: 2, Max: 8}, outcomes: []outcome{exhausted, exhausted, exhausted}, limit: 2},
+		{name: "other error", concurrency: 4, aimd: AIMDConfig{Max: 8}, outcomes: []outcome{failed}, limit: 4},
+		{name: "fixed", concurrency: 3, outcomes: []outcome{exhausted, ok, ok, ok}, limit: 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			l := newLimiter()
+			l.configure(tc.concurrency, tc.aimd)
+
+			for _, o := range tc.outcomes {
+				if err := l.acquire(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+
+				l.release(o.latency, o.err)
+			}
+
+			if limit := l.currentLimit(); limit != tc.limit {
+				t.Fatalf("limit %d expected, %d received", tc.limit, limit)
+			}
+		})
+	}
+}
+
+func TestLimiter_acquire(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		wake   func(l *limiter, cancel context.CancelFunc)
+		err    error
+		leased int // Slots in use after wake up.
+	}{
+		{
+			name:   "release",
+			wake:   func(l *limiter, _ context.CancelFunc) { l.release(0, nil) },
+			leased: 1,
+		},
+		{
+			name:   "limit increase",
+			wake:   func(l *limiter, _ context.CancelFunc) { l.configure(2, AIMDConfig{}) },
+			leased: 2,
+		},
+		{
+			name:   "canceled",
+			wake:   func(_ *limiter, cancel context.CancelFunc) { cancel() },
+			err:    context.Canceled,
+			leased: 1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			l := newLimiter()
+			l.configure(1, AIMDConfig{})
+
+			if !l.tryAcquire() {
+				t.Fatal("free slot expected")
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			done := make(chan error, 1)
+
+			go func() {
+				done <- l.acquire(ctx)
+			}()
+
+			select {
+			case err := <-done:
+				t.Fatalf("acquire must wait for a slot, %v received", err)
+			case <-time.After(20 * time.Millisecond):
+			}
+
+			tc.wake(l, cancel)
+
+			select {
+			case err := <-done:
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("%v expected, %v received", tc.err, err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("acquire did not wake up")
+			}
+
+			l.mu.Lock()
+			leased := l.inFlight
+			l.mu.Unlock()
+
+			if leased != tc.leased {
+				t.Fatalf("%d slots in use expected, %d received", tc.leased, leased)
+			}
+		})
+	}
+}
@@ -0,0 +1,350 @@
+package multi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LoadConfig reads config from JSON or YAML (.yaml, .yml) file, applies defaults and validates it.
+func LoadConfig(fn string) (Config, error) {
+	data, err := os.ReadFile(fn) //nolint:gosec // Config file is provided by the user.
+	if err != nil {
+		return Config{}, err
+	}
+
+	cfg, err := ParseConfig(data, isYAMLFile(fn))
+	if err != nil {
+		return Config{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return cfg, nil
+}
+
+// DecodeConfigFile reads config from JSON or YAML (.yaml, .yml) file and applies defaults without validation.
+//
+// It allows reporting all problems of a config with Config.Validate and Config.Lint.
+func DecodeConfigFile(fn string) (Config, error) {
+	data, err := os.ReadFile(fn) //nolint:gosec // Config file is provided by the user.
+	if err != nil {
+		return Config{}, err
+	}
+
+	cfg, err := decodeConfig(data, isYAMLFile(fn))
+	if err != nil {
+		return Config{}, fmt.Errorf("%s: %w", fn, err)
+	}
+
+	return cfg, nil
+}
+
+func isYAMLFile(fn string) bool {
+	ext := strings.ToLower(filepath.Ext(fn))
+
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// ParseConfig decodes JSON or YAML config, applies defaults from field tags and validates it.
+//
+// Defaults are only applied to absent fields, so explicit zero values are kept.
+func ParseConfig(data []byte, isYAML bool) (Config, error) {
+	cfg, err := decodeConfig(data, isYAML)
+	if err != nil {
+		return Config{}, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+
+	return cfg, nil
+}
+
+// decodeConfig decodes JSON or YAML config and applies defaults from field tags.
+func decodeConfig(data []byte, isYAML bool) (Config, error) {
+	var (
+		v   any
+		err error
+	)
+
+	if isYAML {
+		err = yaml.Unmarshal(data, &v)
+	} else {
+		err = json.Unmarshal(data, &v)
+	}
+
+	if err != nil {
+		return Config{}, fmt.Errorf("decode: %w", err)
+	}
+
+	v = applyDefaults(reflect.TypeOf(Config{}), v)
+
+	data, err = json.Marshal(v)
+	if err != nil {
+		return Config{}, fmt.Errorf("decode: %w", err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var cfg Config
+	if err := dec.Decode(&cfg); err != nil {
+		return Config{}, fmt.Errorf("decode: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// jsonName returns JSON property name of a struct field, or empty string if field is not serialized.
+func jsonName(f reflect.StructField) string {
+	if !f.IsExported() {
+		return ""
+	}
+
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+
+	if name == "" {
+		name = f.Name
+	}
+
+	return name
+}
+
+// applyDefaults sets values of `default` field tags to absent properties of decoded value.
+func applyDefaults(t reflect.Type, v any) any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() { //nolint:exhaustive // Other kinds have no nested properties.
+	case reflect.Struct:
+		m, ok := v.(map[string]any)
+		if !ok {
+			return v
+		}
+
+		for i := range t.NumField() {
+			f := t.Field(i)
+
+			name := jsonName(f)
+			if name == "" {
+				continue
+			}
+
+			if fv, ok := m[name]; ok {
+				m[name] = applyDefaults(f.Type, fv)
+
+				continue
+			}
+
+			def, ok := f.Tag.Lookup("default")
+			if !ok {
+				continue
+			}
+
+			if f.Type.Kind() == reflect.String {
+				m[name] = def
+
+				continue
+			}
+
+			var dv any
+			if err := json.Unmarshal([]byte(def), &dv); err == nil {
+				m[name] = dv
+			} else {
+				m[name] = def
+			}
+		}
+	case reflect.Slice:
+		items, ok := v.([]any)
+		if !ok {
+			return v
+		}
+
+		for i, item := range items {
+			items[i] = applyDefaults(t.Elem(), item)
+		}
+	}
+
+	return v
+}
+
+type enumer interface {
+	Enum() []any
+}
+
+// Validate checks config against constraints of field tags and enums.
+func (c Config) Validate() error {
+	var errs []error
+
+	validateValue("", reflect.ValueOf(c), &errs)
+
+	providers := map[string]bool{}
+
+	for i, p := range c.Providers {
+		id := p.Provider.ID()
+		if providers[id] {
+			errs = append(errs, fmt.Errorf("providers[%d].provider: duplicate name %q", i, id))
+		}
+
+		providers[id] = true
+	}
+
+	prompts := map[string]bool{}
+
+	for i, p := range c.Prompts {
+		id := p.ID()
+		if prompts[id] {
+			errs = append(errs, fmt.Errorf("prompts[%d]: duplicate name %q", i, id))
+		}
+
+		prompts[id] = true
+	}
+
+	return errors.Join(errs...)
+}
+
+func validateValue(path string, v reflect.Value, errs *[]error) {
+	if v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+
+		v = v.Elem()
+	}
+
+	if e, ok := v.Interface().(enumer); ok && !v.IsZero() {
+		if !slices.Contains(e.Enum(), v.Interface()) {
+			*errs = append(*errs, fmt.Errorf("%s: unexpected value %v, allowed values: %v", path, v.Interface(), e.Enum()))
+		}
+	}
+
+	switch v.Kind() { //nolint:exhaustive // Other kinds have no nested properties.
+	case reflect.Struct:
+		t := v.Type()
+
+		for i := range t.NumField() {
+			f := t.Field(i)
+
+			name := jsonName(f)
+			if name == "" {
+				continue
+			}
+
+			p := name
+			if path != "" {
+				p = path + "." + name
+			}
+
+			fv := v.Field(i)
+
+			if ml, ok := f.Tag.Lookup("minLength"); ok {
+				if n, err := strconv.Atoi(ml); err == nil {
+					switch fv.Kind() { //nolint:exhaustive // Only sized kinds are checked.
+					case reflect.Slice, reflect.String, reflect.Map:
+						if fv.Len() < n {
+							*errs = append(*errs, fmt.Errorf("%s: length %d is less than minimum %d", p, fv.Len(), n))
+						}
+					}
+				}
+			}
+
+			validateValue(p, fv, errs)
+		}
+	case reflect.Slice:
+		for i := range v.Len() {
+			validateValue(path+"["+strconv.Itoa(i)+"]", v.Index(i), errs)
+		}
+	}
+}
+
+// ConfigWatcher polls config file for changes and keeps the last valid config.
+type ConfigWatcher struct {
+	fn      string
+	onError func(err error)
+
+	cfg  atomic.Pointer[Config]
+	data []byte
+	done chan struct{}
+}
+
+// WatchConfig loads config file and polls it for changes with a given interval.
+//
+// Changed config is swapped atomically. Invalid config is rejected with an error
+// passed to onError (if not nil), while the previous config stays active.
+func WatchConfig(fn string, interval time.Duration, onError func(err error)) (*ConfigWatcher, error) {
+	w := &ConfigWatcher{
+		fn:      fn,
+		onError: onError,
+		done:    make(chan struct{}),
+	}
+
+	if err := w.reload(); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-w.done:
+				return
+			case <-t.C:
+				if err := w.reload(); err != nil && w.onError != nil {
+					w.onError(fmt.Errorf("reload config, keeping previous: %w", err))
+				}
+			}
+		}
+	}()
+
+	return w, nil
+}
+
+func (w *ConfigWatcher) reload() error {
+	data, err := os.ReadFile(w.fn)
+	if err != nil {
+		return err
+	}
+
+	if w.data != nil && bytes.Equal(data, w.data) {
+		return nil
+	}
+
+	// Remember data to avoid reporting same invalid config on every poll.
+	w.data = data
+
+	cfg, err := ParseConfig(data, isYAMLFile(w.fn))
+	if err != nil {
+		return fmt.Errorf("%s: %w", w.fn, err)
+	}
+
+	w.cfg.Store(&cfg)
+
+	return nil
+}
+
+// Config returns current config, it can be used as ImagePrompter config accessor.
+func (w *ConfigWatcher) Config() Config {
+	return *w.cfg.Load()
+}
+
+// Close stops polling.
+func (w *ConfigWatcher) Close() {
+	close(w.done)
+}
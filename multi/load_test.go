@@ -0,0 +1,126 @@
+package multi
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestApplyDefaults(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		in   string
+		out  string
+	}{
+		{
+			name: "absent fields",
+			in:   `{"prompts":[{"name":"p"}],"providers":[{"provider":{"type":"ollama"}}]}`,
+			out: `{"prompts":[{"name":"p","prompt":"Generate a detailed caption for this image, don't name the places, items or people unless you're sure.","weight":1}],` +
+				`"providers":[{"provider":{"type":"ollama","concurrency":1},"weight":1}]}`,
+		},
+		{
+			name: "explicit zero kept",
+			in:   `{"prompts":[{"prompt":"","weight":0}],"providers":[{"provider":{"concurrency":0},"weight":0}],"shadow":{"concurrency":0}}`,
+			out:  `{"prompts":[{"prompt":"","weight":0}],"providers":[{"provider":{"concurrency":0},"weight":0}],"shadow":{"concurrency":0}}`,
+		},
+		{
+			name: "explicit value kept",
+			in:   `{"prompts":[{"prompt":"caption","weight":3}],"providers":[{"provider":{"concurrency":5},"weight":2}]}`,
+			out:  `{"prompts":[{"prompt":"caption","weight":3}],"providers":[{"provider":{"concurrency":5},"weight":2}]}`,
+		},
+		{
+			name: "nested object",
+			in:   `{"shadow":{"fraction":0.1}}`,
+			out:  `{"shadow":{"fraction":0.1,"concurrency":1}}`,
+		},
+		{
+			name: "unexpected types ignored",
+			in:   `{"prompts":"none","providers":[1]}`,
+			out:  `{"prompts":"none","providers":[1]}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var in, out any
+
+			if err := json.Unmarshal([]byte(tc.in), &in); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := json.Unmarshal([]byte(tc.out), &out); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := applyDefaults(reflect.TypeOf(Config{}), in); !reflect.DeepEqual(got, out) {
+				j, _ := json.Marshal(got) //nolint:errchkjson
+
+				t.Fatalf("unexpected result: %s", j)
+			}
+		})
+	}
+}
+
+func TestWatchConfig(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "config.yaml")
+
+	write := func(s string) {
+		t.Helper()
+
+		if err := os.WriteFile(fn, []byte(s), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("prompts: [{prompt: one}]\nproviders: [{provider: {type: ollama}}]\n")
+
+	errs := make(chan error, 10)
+
+	w, err := WatchConfig(fn, 5*time.Millisecond, func(err error) { errs <- err })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	for _, tc := range []struct {
+		name   string
+		data   string
+		prompt string
+		err    bool
+	}{
+		{name: "invalid yaml", data: "prompts: [", prompt: "one", err: true},
+		{name: "failed validation", data: "prompts: []\nproviders: []\n", prompt: "one", err: true},
+		{name: "unknown field", data: "prompts: [{prompt: two}]\nproviders: [{provider: {type: ollama}}]\nfoo: 1\n", prompt: "one", err: true},
+		{name: "valid", data: "prompts: [{prompt: two}]\nproviders: [{provider: {type: ollama}}]\n", prompt: "two"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			write(tc.data)
+
+			deadline := time.After(5 * time.Second)
+
+			for {
+				if !tc.err && w.Config().Prompts[0].Prompt == tc.prompt {
+					break
+				}
+
+				select {
+				case err := <-errs:
+					if !tc.err {
+						t.Fatal(err)
+					}
+				case <-deadline:
+					t.Fatal("config is not reloaded")
+				case <-time.After(time.Millisecond):
+					continue
+				}
+
+				break
+			}
+
+			if p := w.Config().Prompts[0].Prompt; p != tc.prompt {
+				t.Fatalf("prompt %q expected, %q received", tc.prompt, p)
+			}
+		})
+	}
+}
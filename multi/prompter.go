@@ -2,26 +2,66 @@
 package multi
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"math/rand/v2"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/vearutop/image-prompt/cache"
 	"github.com/vearutop/image-prompt/cloudflare"
 	"github.com/vearutop/image-prompt/gemini"
 	"github.com/vearutop/image-prompt/imageprompt"
 	"github.com/vearutop/image-prompt/ollama"
 	"github.com/vearutop/image-prompt/openai"
+	"github.com/vearutop/image-prompt/secret"
 )
 
+var _ imageprompt.ResponsePrompter = &ImagePrompter{}
+
 // ImagePrompter can ask LLMs about an image.
+//
+// ImagePrompter implements imageprompt.Prompter, so it can be used anywhere a single
+// provider is accepted, including as a Provider of another ImagePrompter.
 type ImagePrompter struct {
-	prompterExhaustedUntil smap[Provider, time.Time]
-	prompterSemaphore      smap[Provider, chan struct{}]
-
-	rng *rand.Rand
+	// OnError is called with background errors, for example a failure to persist spend.
+	OnError func(err error)
+
+	// Validator is a custom output validator, it runs after configured checks of Config.Validation.
+	Validator Validator
+
+	// Cache is a custom response cache store, it is used instead of a directory of Config.Cache.
+	Cache cache.Store
+
+	prompterExhaustedUntil smap[string, time.Time]
+	limiters               smap[string, *limiter]
+	keyCursor              smap[string, *atomic.Uint64]
+	transports             smap[string, cachedTransport]
+	prompters              smap[string, cachedPrompter]
+	breakers               smap[string, *breaker]
+	providerStats          smap[string, *stats]
+	strategies             smap[string, Strategy]
+	patterns               smap[string, *regexp.Regexp]
+	caches                 smap[string, *cache.FS]
+	flights                flightGroup
+	spend                  spendTracker
+	feedback               feedbackTracker
+	experiments            jsonlLog
+	shadows                jsonlLog
+	shadowLimiter          *limiter
+	shadowWG               sync.WaitGroup
+
+	rngMu sync.Mutex
+	rng   *rand.Rand
 
 	cfgAccessor func() Config
 }
@@ -33,118 +73,357 @@ func NewImagePrompter(cfg func() Config) *ImagePrompter {
 	mp := &ImagePrompter{}
 
 	mp.rng = rand.New(rand.NewPCG(1, 1))
+	mp.shadowLimiter = newLimiter()
 	mp.cfgAccessor = cfg
 
 	return mp
 }
 
 type prompter struct {
-	prompt string
-	p      Provider
-	sem    chan struct{}
+	prompt     string
+	promptName string
+	p          Provider
+	keyIndex   int
+	lim        *limiter
+	state      string // ID of runtime state (limiter, exhausted keys, breaker, stats), provider ID by default.
 }
 
-func (ip *ImagePrompter) pp(cfg Config) (prompter, error) {
-	if len(cfg.Providers) == 0 || len(cfg.Prompts) == 0 {
-		return prompter{}, imageprompt.ErrEmptyConfig
+// keyID identifies auth key of a provider for exhaustion tracking without exposing the key.
+func keyID(providerID string, keyIndex int) string {
+	return providerID + "#" + strconv.Itoa(keyIndex)
+}
+
+// availableKeys returns indexes of auth keys that are not exhausted.
+func (ip *ImagePrompter) availableKeys(id string, p Provider) []int {
+	n := max(1, len(p.authKeys()))
+	res := make([]int, 0, n)
+
+	for i := range n {
+		k := keyID(id, i)
+
+		exhausted, _ := ip.prompterExhaustedUntil.Load(k)
+		if !exhausted.IsZero() {
+			if exhausted.After(time.Now()) {
+				continue
+			}
+
+			ip.prompterExhaustedUntil.Store(k, time.Time{})
+		}
+
+		res = append(res, i)
 	}
 
-	prompt := cfg.Prompts[0].Prompt
-	provider := Provider{}
+	return res
+}
 
+// nextKey rotates available auth keys of a provider.
+func (ip *ImagePrompter) nextKey(id string, available []int) int {
+	c, _ := ip.keyCursor.LoadOrStore(id, &atomic.Uint64{})
+
+	return available[int(c.Add(1)%uint64(len(available)))] //nolint:gosec // Length is positive.
+}
+
+// pick returns weighted random index, or -1 if total weight is not positive.
+func (ip *ImagePrompter) pick(weights []int) int {
 	sumWeight := 0
-	for _, pr := range cfg.Prompts {
-		sumWeight += pr.Weight
+	for _, w := range weights {
+		if w > 0 {
+			sumWeight += w
+		}
 	}
 
+	if sumWeight <= 0 {
+		return -1
+	}
+
+	ip.rngMu.Lock()
 	r := ip.rng.IntN(sumWeight)
+	ip.rngMu.Unlock()
 
 	sumWeight = 0
-	for _, pr := range cfg.Prompts {
-		sumWeight += pr.Weight
 
-		if sumWeight >= r {
-			prompt = pr.Prompt
+	for i, w := range weights {
+		if w <= 0 {
+			continue
+		}
 
-			break
+		sumWeight += w
+
+		if sumWeight > r {
+			return i
 		}
 	}
 
-	sumWeight = 0
-	exhaustedFound := false
+	return -1
+}
 
-	for i, pr := range cfg.Providers {
-		exhausted, _ := ip.prompterExhaustedUntil.Load(pr.Provider)
-		if !exhausted.IsZero() {
-			if exhausted.Before(time.Now()) {
-				ip.prompterExhaustedUntil.Store(pr.Provider, time.Time{})
-			} else {
-				pr.Weight = 0
-				cfg.Providers[i] = pr
-				exhaustedFound = true
+func (ip *ImagePrompter) pickPrompt(cfg Config, routing Routing) (prompt string, name string, err error) {
+	if len(cfg.Prompts) == 0 {
+		return "", "", imageprompt.ErrEmptyConfig
+	}
+
+	if routing.Prompt != "" {
+		for _, pr := range cfg.Prompts {
+			if pr.ID() == routing.Prompt {
+				return pr.Prompt, pr.ID(), nil
 			}
 		}
 
-		sumWeight += pr.Weight
+		return "", "", ErrNoMatchingPrompt{Name: routing.Prompt}
+	}
+
+	var i int
+
+	switch cfg.PromptStrategy {
+	case StrategyThompson, StrategyUCB:
+		fb, _, err := ip.feedback.feedback(cfg.Bandit.StateFile)
+		ip.reportError(err)
+
+		arms := make([]arm, len(cfg.Prompts))
+		for j, pr := range cfg.Prompts {
+			arms[j] = arm{weight: pr.Weight, feedback: fb[pr.ID()]}
+		}
+
+		i = ip.banditPick(cfg.PromptStrategy, cfg.Bandit.withDefaults(), arms)
+	default:
+		weights := make([]int, len(cfg.Prompts))
+		for j, pr := range cfg.Prompts {
+			weights[j] = pr.Weight
+		}
+
+		i = ip.pick(weights)
+	}
+
+	if i == -1 {
+		i = 0
+	}
+
+	return cfg.Prompts[i].Prompt, cfg.Prompts[i].ID(), nil
+}
+
+// choosePrompt returns prompter without provider, prompt is picked from config if empty.
+func (ip *ImagePrompter) choosePrompt(cfg Config, prompt string, routing Routing) (prompter, error) {
+	if len(cfg.Providers) == 0 {
+		return prompter{}, imageprompt.ErrEmptyConfig
+	}
+
+	if prompt != "" {
+		return prompter{prompt: prompt}, nil
+	}
+
+	prompt, promptName, err := ip.pickPrompt(cfg, routing)
+	if err != nil {
+		return prompter{}, err
+	}
+
+	return prompter{prompt: prompt, promptName: promptName}, nil
+}
+
+// withProvider picks provider for a chosen prompt.
+func (ip *ImagePrompter) withProvider(cfg Config, pr prompter, routing Routing) (prompter, error) {
+	provider, err := ip.pickProvider(cfg, routing)
+	if err != nil {
+		return prompter{}, err
+	}
+
+	return ip.prompter(pr.prompt, pr.promptName, provider), nil
+}
+
+func (ip *ImagePrompter) pickProvider(cfg Config, routing Routing) (Provider, error) {
+	if len(cfg.Providers) == 0 {
+		return Provider{}, imageprompt.ErrEmptyConfig
 	}
 
-	r = ip.rng.IntN(sumWeight)
+	if err := checkUnique(cfg.Providers); err != nil {
+		return Provider{}, err
+	}
+
+	var (
+		matchFound     = false
+		exhaustedFound = false
+		openFound      = false
+		overBudget     = false
+		now            = time.Now()
+		candidates     = make([]Candidate, 0, len(cfg.Providers))
+		providers      = make([]Provider, 0, len(cfg.Providers))
+	)
+
+	_, feedback, err := ip.feedback.feedback(cfg.Bandit.StateFile)
+	ip.reportError(err)
 
 	for _, pr := range cfg.Providers {
-		sumWeight += pr.Weight
+		if !routing.matches(pr.Provider) {
+			continue
+		}
+
+		matchFound = true
 
-		if sumWeight >= r {
-			provider = pr.Provider
+		if len(ip.availableKeys(pr.Provider.ID(), pr.Provider)) == 0 {
+			exhaustedFound = true
 
-			break
+			continue
 		}
+
+		if ip.overBudget(cfg, pr.Provider, now) {
+			overBudget = true
+
+			continue
+		}
+
+		id := pr.Provider.ID()
+
+		if bc := pr.Provider.Breaker; bc.enabled() && !ip.breaker(id).available(bc.withDefaults(), now) {
+			openFound = true
+
+			continue
+		}
+
+		candidates = append(candidates, Candidate{Provider: id, Weight: pr.Weight, Stats: ip.stats(id).snapshot()})
+		providers = append(providers, pr.Provider)
 	}
 
-	if provider.Type == "" && exhaustedFound {
-		return prompter{
-			p: provider,
-		}, imageprompt.ErrResourceExhausted
+	if !matchFound {
+		return Provider{}, ErrNoMatchingProvider{Routing: routing}
 	}
 
-	if provider.Concurrency == 0 {
-		provider.Concurrency = 1
+	for i, c := range candidates {
+		candidates[i].Feedback = feedback[c.Provider]
 	}
 
-	sem, _ := ip.prompterSemaphore.Load(provider)
-	if sem == nil {
-		sem = make(chan struct{}, provider.Concurrency)
-		ip.prompterSemaphore.Store(provider, sem)
-	} else if cap(sem) != provider.Concurrency {
-		// Wait for all in progress requests to finish.
-		for i := 0; i < cap(sem); i++ {
-			sem <- struct{}{}
+	strategy := ip.strategy(cfg)
+
+	for {
+		i := -1
+		if len(candidates) > 0 {
+			i = strategy.Pick(candidates)
+		}
+
+		if i < 0 || i >= len(candidates) {
+			switch {
+			case exhaustedFound:
+				return Provider{}, imageprompt.ErrResourceExhausted
+			case overBudget:
+				return Provider{}, imageprompt.ErrBudgetExceeded
+			case openFound:
+				return Provider{}, imageprompt.ErrCircuitOpen
+			default:
+				return Provider{}, imageprompt.ErrEmptyConfig
+			}
 		}
 
-		// Replace semaphore.
-		sem = make(chan struct{}, provider.Concurrency)
-		ip.prompterSemaphore.Store(provider, sem)
+		provider := providers[i]
+
+		// Breaker in half-open state only allows limited number of concurrent probes.
+		if bc := provider.Breaker; bc.enabled() && !ip.breaker(provider.ID()).acquire(bc.withDefaults(), now) {
+			candidates = slices.Delete(candidates, i, i+1)
+			providers = slices.Delete(providers, i, i+1)
+			openFound = true
+
+			continue
+		}
+
+		return provider, nil
 	}
+}
 
-	return prompter{prompt: prompt, p: provider, sem: sem}, nil
+func (ip *ImagePrompter) prompter(prompt, promptName string, provider Provider) prompter {
+	return ip.statePrompter(provider.ID(), prompt, promptName, provider)
 }
 
-func (p Provider) prompter() (imageprompt.Prompter, error) {
+// statePrompter creates prompter that keeps runtime state of provider under a given ID.
+func (ip *ImagePrompter) statePrompter(state, prompt, promptName string, provider Provider) prompter {
+	keyIndex := 0
+	if available := ip.availableKeys(state, provider); len(available) > 0 {
+		keyIndex = ip.nextKey(state, available)
+	}
+
+	return prompter{
+		prompt:     prompt,
+		promptName: promptName,
+		p:          provider,
+		keyIndex:   keyIndex,
+		lim:        ip.limiter(state, provider),
+		state:      state,
+	}
+}
+
+// authKeys returns all configured auth keys.
+func (p Provider) authKeys() []string {
+	if p.AuthKey == "" {
+		return p.AuthKeys
+	}
+
+	return append([]string{p.AuthKey}, p.AuthKeys...)
+}
+
+// resolved returns a copy of provider with a single auth key selected by index and secret references resolved.
+func (p Provider) resolved(ctx context.Context, keyIndex int) (Provider, error) {
+	var err error
+
+	if keys := p.authKeys(); keyIndex < len(keys) {
+		p.AuthKey = keys[keyIndex]
+		p.AuthKeys = nil
+	}
+
+	if p.AuthKey, err = secret.Resolve(ctx, p.AuthKey); err != nil {
+		return p, fmt.Errorf("%s: auth key %d: %w", p.ID(), keyIndex, err)
+	}
+
+	imageprompt.RegisterSecret(p.AuthKey)
+
+	if len(p.HTTP.Headers) > 0 {
+		headers := make(map[string]string, len(p.HTTP.Headers))
+
+		for k, v := range p.HTTP.Headers {
+			if headers[k], err = secret.Resolve(ctx, v); err != nil {
+				return p, fmt.Errorf("%s: header %s: %w", p.ID(), k, err)
+			}
+		}
+
+		p.HTTP.Headers = headers
+	}
+
+	if p.Type == CloudFlare && p.BaseURL != "" {
+		if p.BaseURL, err = secret.ResolveUserinfo(ctx, p.BaseURL); err != nil {
+			return p, fmt.Errorf("%s: base url: %w", p.ID(), err)
+		}
+	}
+
+	return p, nil
+}
+
+func (p Provider) prompter(tr http.RoundTripper) (imageprompt.Prompter, error) {
+	if p.Prompter != nil {
+		return p.Prompter, nil
+	}
+
 	switch p.Type {
 	case OpenAI:
 		return &openai.ImagePrompter{
-			AuthKey: p.AuthKey,
-			Model:   p.Model,
+			AuthKey:   p.AuthKey,
+			Model:     p.Model,
+			Transport: tr,
 		}, nil
 	case Gemini:
 		return &gemini.ImagePrompter{
-			AuthKey: p.AuthKey,
+			AuthKey:   p.AuthKey,
+			Transport: tr,
 		}, nil
 	case Ollama:
 		return &ollama.ImagePrompter{
-			Model: p.Model,
+			BaseURL:   p.BaseURL,
+			Model:     p.Model,
+			Transport: tr,
 		}, nil
 	case CloudFlare:
-		return cloudflare.NewImagePrompter(p.BaseURL)
+		cf, err := cloudflare.NewImagePrompter(p.BaseURL)
+		if err != nil {
+			return nil, err
+		}
+
+		cf.Transport = tr
+
+		return cf, nil
 	default:
 		return nil, errors.New("no provider")
 	}
@@ -152,42 +431,314 @@ func (p Provider) prompter() (imageprompt.Prompter, error) {
 
 // Result is the prompt response.
 type Result struct {
-	Text   string `json:"text,omitempty"`
-	Model  string `json:"model,omitempty"`
-	Prompt string `json:"prompt,omitempty"`
+	Text       string            `json:"text,omitempty"`
+	Model      string            `json:"model,omitempty"`
+	Prompt     string            `json:"prompt,omitempty"`
+	PromptName string            `json:"prompt_name,omitempty"` // Empty for caller-supplied prompt.
+	Usage      imageprompt.Usage `json:"usage"`
+	Cost       float64           `json:"cost,omitempty"`       // Calculated with Config.Prices.
+	Provider   string            `json:"provider,omitempty"`   // Provider ID, empty for voted ensemble result.
+	KeyIndex   int               `json:"key_index,omitempty"`  // Index of provider auth key, the key itself is never exposed.
+	Hedged     bool              `json:"hedged,omitempty"`     // Hedged request was sent to another provider.
+	ID         string            `json:"id,omitempty"`         // Unique result ID to report feedback.
+	Latency    time.Duration     `json:"latency,omitempty"`    // Time to get result, including retries and hedging.
+	Candidates []Result          `json:"candidates,omitempty"` // Results of ensemble providers, or replaced low-confidence result.
+	Rationale  string            `json:"rationale,omitempty"`  // Explanation of ensemble merge.
+
+	// Alternatives are generated when requested with imageprompt.WithOptions, the first one is also in Text.
+	Alternatives []imageprompt.Alternative `json:"alternatives,omitempty"`
+
+	Confidence float64                    `json:"confidence,omitempty"` // From 0 to 1, 0 if provider does not report it.
+	Logprobs   []imageprompt.TokenLogprob `json:"logprobs,omitempty"`   // Requested with imageprompt.Options.
+	Escalated  bool                       `json:"escalated,omitempty"`  // Low-confidence result was re-routed to a stronger provider.
+	Validation *Validation                `json:"validation,omitempty"` // Verdict of output validation, if enabled.
+	Critique   *Critique                  `json:"critique,omitempty"`   // Self-critique passes, if enabled.
+	Cached     bool                       `json:"cached,omitempty"`     // Response is served from cache, it has no cost.
+	Shared     bool                       `json:"shared,omitempty"`     // Result of identical concurrent request is reused.
 }
 
-// PromptImage asks LLM about JPEG image with one of predefined prompts.
-func (ip *ImagePrompter) PromptImage(ctx context.Context, jpegImage io.Reader) (Result, error) {
-	p, err := ip.pp(ip.cfgAccessor())
+// ModelName returns composite name of configured models, e.g. "multi(gpt-4o-mini,llava:7b)".
+func (ip *ImagePrompter) ModelName() string {
+	var names []string
+
+	seen := map[string]bool{}
+
+	for _, pr := range ip.cfgAccessor().Providers {
+		p, err := pr.Provider.prompter(nil)
+		if err != nil {
+			continue
+		}
+
+		name := p.ModelName()
+		if seen[name] {
+			continue
+		}
+
+		seen[name] = true
+
+		names = append(names, name)
+	}
+
+	return "multi(" + strings.Join(names, ",") + ")"
+}
+
+// PromptImage asks LLM about JPEG image.
+//
+// If prompt is empty, one of predefined prompts is used.
+func (ip *ImagePrompter) PromptImage(ctx context.Context, prompt string, jpegImage io.Reader) (string, error) {
+	res, err := ip.PromptImageResult(ctx, prompt, jpegImage)
 	if err != nil {
+		return "", err
+	}
+
+	return res.Text, nil
+}
+
+// PromptImageResponse asks LLM about JPEG image and returns text with usage.
+//
+// If prompt is empty, one of predefined prompts is used.
+func (ip *ImagePrompter) PromptImageResponse(ctx context.Context, prompt string, jpegImage io.Reader) (imageprompt.Response, error) {
+	res, err := ip.PromptImageResult(ctx, prompt, jpegImage)
+	if err != nil {
+		return imageprompt.Response{}, err
+	}
+
+	return imageprompt.Response{
+		Text:         res.Text,
+		Usage:        res.Usage,
+		Alternatives: res.Alternatives,
+		Confidence:   res.Confidence,
+		Logprobs:     res.Logprobs,
+		Cached:       res.Cached,
+	}, nil
+}
+
+// PromptImageResult asks LLM about JPEG image and returns detailed result.
+//
+// If prompt is empty, one of predefined prompts is used.
+// Routing overrides can be provided with WithRouting, request options with imageprompt.WithOptions.
+// Returned errors are redacted with imageprompt.RedactError.
+func (ip *ImagePrompter) PromptImageResult(ctx context.Context, prompt string, jpegImage io.Reader) (Result, error) {
+	res, err := ip.promptImageResult(ctx, prompt, jpegImage)
+
+	return res, imageprompt.RedactError(err)
+}
+
+func (ip *ImagePrompter) promptImageResult(ctx context.Context, prompt string, jpegImage io.Reader) (Result, error) {
+	img, err := io.ReadAll(jpegImage)
+	if err != nil {
+		return Result{}, err
+	}
+
+	if cfg := ip.cfgAccessor(); cfg.Dedup {
+		res, err := ip.dedup(ctx, dedupKey(ctx, prompt, img), func(ctx context.Context) (Result, error) {
+			return ip.result(ctx, prompt, img)
+		})
+
+		// Each waiter of a shared request receives its own result ID for feedback.
+		if err == nil && res.Shared {
+			res = ip.track(cfg, res)
+		}
+
+		return res, err
+	}
+
+	return ip.result(ctx, prompt, img)
+}
+
+// track assigns new ID to a result, registers it for feedback and writes it to experiment log.
+func (ip *ImagePrompter) track(cfg Config, res Result) Result {
+	res.ID = newResultID()
+	ip.feedback.track(res.ID, pendingResult{promptName: res.PromptName, provider: res.Provider})
+	ip.logResult(cfg, res)
+
+	return res
+}
+
+func (ip *ImagePrompter) result(ctx context.Context, prompt string, img []byte) (Result, error) {
+	routing, _ := RoutingFromContext(ctx)
+	requested := routing
+	started := time.Now()
+
+	var (
+		rejections []Rejection
+		rejected   Result
+	)
+
+	for {
+		cfg := ip.cfgAccessor()
+
+		var res Result
+
+		p, err := ip.choosePrompt(cfg, prompt, routing)
+		if err != nil {
+			return Result{}, err
+		}
+
+		// Final result is cached, so that a hit does not depend on availability of providers
+		// and does not pay for escalation and critique again.
+		key := resultKey(ctx, p.prompt, requested, img)
+
+		if res, found := ip.cached(ctx, cfg, key); found {
+			res.Latency = time.Since(started)
+
+			return ip.track(cfg, res), nil
+		}
+
+		if routing.Ensemble {
+			res, err = ip.ensemble(ctx, cfg, p, routing, img)
+		} else {
+			if p, err = ip.withProvider(cfg, p, routing); err != nil {
+				if len(rejections) > 0 {
+					// No more providers to retry rejected output.
+					return rejected, ErrInvalidOutput{Reason: rejections[len(rejections)-1].Reason}
+				}
+
+				return Result{}, err
+			}
+
+			rctx := cfg.Confidence.withConfidence(ctx)
+
+			res, err = ip.hedged(rctx, cfg, p, routing, img)
+			if errors.Is(err, imageprompt.ErrResourceExhausted) {
+				continue
+			}
+
+			if err == nil {
+				res = ip.escalate(rctx, cfg, res, img)
+			}
+		}
+
+		if err != nil {
+			return res, err
+		}
+
+		res = ip.critique(ctx, cfg, res, img)
+
+		if verr := ip.validate(cfg.Validation, res); verr != nil {
+			rejections = append(rejections, Rejection{
+				Provider:   res.Provider,
+				PromptName: res.PromptName,
+				Text:       res.Text,
+				Reason:     verr.Error(),
+			})
+
+			res.Validation = &Validation{Rejections: rejections}
+			rejected = res
+
+			if !routing.Ensemble && res.Provider != "" && len(rejections) <= cfg.Validation.retries() {
+				routing.Exclude = append(slices.Clone(routing.Exclude), res.Provider)
+
+				continue
+			}
+
+			return res, ErrInvalidOutput{Reason: verr.Error()}
+		}
+
+		if cfg.Validation.enabled() || ip.Validator != nil {
+			res.Validation = &Validation{Passed: true, Rejections: rejections}
+		}
+
+		ip.storeResult(ctx, cfg, key, res)
+
+		res.Latency = time.Since(started)
+		res = ip.track(cfg, res)
+		ip.shadow(ctx, cfg, p, res, img)
+
+		return res, nil
+	}
+}
+
+// markExhausted takes auth key of provider out of rotation for a minute.
+func (ip *ImagePrompter) markExhausted(p prompter) {
+	ip.prompterExhaustedUntil.Store(keyID(p.state, p.keyIndex), time.Now().Add(time.Minute))
+}
+
+func (ip *ImagePrompter) do(ctx context.Context, cfg Config, p prompter, img []byte) (res Result, err error) {
+	parent := ctx
+	start := time.Now()
+
+	defer func() {
+		v := classify(parent, err)
+		if v == verdictNeutral {
+			return
+		}
+
+		ip.stats(p.state).observe(cfg.Adaptive.withDefaults().Alpha, time.Since(start), v == verdictFailure, res.Cost)
+	}()
+
+	if bc := p.p.Breaker; bc.enabled() {
+		defer func() {
+			ip.breaker(p.state).report(bc.withDefaults(), time.Now(), classify(parent, err))
+		}()
+	}
+
+	if err := p.lim.acquire(ctx); err != nil {
 		return Result{}, err
 	}
 
-	p.sem <- struct{}{}
-	defer func() { <-p.sem }()
+	started := time.Now()
+
+	defer func() { p.lim.release(time.Since(started), err) }()
 
-	pr, err := p.p.prompter()
+	rp, err := p.p.resolved(ctx, p.keyIndex)
 	if err != nil {
 		return Result{}, err
 	}
 
-	res, err := pr.PromptImage(ctx, p.prompt, jpegImage)
+	pr, err := ip.driver(p.state, rp, p.keyIndex)
 	if err != nil {
 		return Result{}, err
 	}
 
-	if errors.Is(err, imageprompt.ErrResourceExhausted) {
-		ip.prompterExhaustedUntil.Store(p.p, time.Now().Add(time.Minute))
+	ctx, cancel := context.WithTimeout(ctx, rp.HTTP.timeout())
+	defer cancel()
+
+	if p.p.Prompter != nil {
+		ctx = withoutRouting(ctx)
+	}
+
+	model := pr.ModelName()
 
-		return ip.PromptImage(ctx, jpegImage)
+	resp, err := imageprompt.PromptImageResponse(ctx, pr, p.prompt, bytes.NewReader(img))
+	if err != nil {
+		if errors.Is(err, imageprompt.ErrResourceExhausted) {
+			ip.markExhausted(p)
+		}
+
+		// Canceled request, for example a slower one of hedged requests, may still be billed by provider.
+		if errors.Is(err, context.Canceled) && parent.Err() != nil {
+			if cost := ip.stats(p.state).snapshot().Cost; cost > 0 {
+				ip.reportError(ip.spend.add(cfg.SpendFile, p.p.ID(), time.Now(), cost))
+			}
+		}
+
+		return Result{}, err
 	}
 
+	cost := cfg.Prices[model].cost(resp.Usage)
+	if cost > 0 {
+		ip.reportError(ip.spend.add(cfg.SpendFile, p.p.ID(), time.Now(), cost))
+	}
+
+	return p.result(resp, model, cost), nil
+}
+
+func (p prompter) result(resp imageprompt.Response, model string, cost float64) Result {
 	return Result{
-		Text:   res,
-		Model:  pr.ModelName(),
-		Prompt: p.prompt,
-	}, nil
+		Text:         resp.Text,
+		Alternatives: resp.Alternatives,
+		Cached:       resp.Cached,
+		Confidence:   resp.Confidence,
+		Logprobs:     resp.Logprobs,
+		Usage:        resp.Usage,
+		Cost:         cost,
+		Model:        model,
+		Prompt:       p.prompt,
+		PromptName:   p.promptName,
+		Provider:     p.p.ID(),
+		KeyIndex:     p.keyIndex,
+	}
 }
 
 type smap[K comparable, V any] struct {
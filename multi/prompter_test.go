@@ -0,0 +1,326 @@
+package multi_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vearutop/image-prompt/imageprompt"
+	"github.com/vearutop/image-prompt/multi"
+)
+
+type stubPrompter struct {
+	text       string
+	err        error
+	confidence float64
+	calls      int
+}
+
+func (s *stubPrompter) PromptImage(ctx context.Context, prompt string, img io.Reader) (string, error) {
+	res, err := s.PromptImageResponse(ctx, prompt, img)
+
+	return res.Text, err
+}
+
+func (s *stubPrompter) PromptImageResponse(_ context.Context, _ string, _ io.Reader) (imageprompt.Response, error) {
+	s.calls++
+
+	return imageprompt.Response{Text: s.text, Confidence: s.confidence}, s.err
+}
+
+func (s *stubPrompter) ModelName() string {
+	return "stub"
+}
+
+func TestImagePrompter_PromptImageResult_duplicateID(t *testing.T) {
+	cfg := multi.Config{
+		Prompts: []multi.WeightedPrompt{{Prompt: "caption", Weight: 1}},
+		Providers: []multi.WeightedProvider{
+			{Provider: multi.Provider{Prompter: &stubPrompter{err: imageprompt.ErrResourceExhausted}}, Weight: 1},
+			{Provider: multi.Provider{Prompter: &stubPrompter{text: "ok"}}, Weight: 1},
+		},
+	}
+
+	ip := multi.NewImagePrompter(func() multi.Config { return cfg })
+
+	_, err := ip.PromptImageResult(context.Background(), "", bytes.NewReader(nil))
+
+	var de multi.ErrDuplicateProvider
+	if !errors.As(err, &de) || de.ID != "custom" {
+		t.Fatalf("duplicate provider error expected, %v received", err)
+	}
+
+	cfg.Providers[0].Provider.Name = "a"
+	cfg.Providers[1].Provider.Name = "b"
+
+	// Exhaustion of one provider must not affect another one.
+	for range 10 {
+		res, err := ip.PromptImageResult(context.Background(), "", bytes.NewReader(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.Provider != "b" {
+			t.Fatalf("provider b expected, %s received", res.Provider)
+		}
+	}
+}
+
+type mapStore map[string][]byte
+
+func (m mapStore) Get(_ context.Context, key string) ([]byte, bool, error) {
+	v, ok := m[key]
+
+	return v, ok, nil
+}
+
+func (m mapStore) Set(_ context.Context, key string, v []byte) error {
+	m[key] = v
+
+	return nil
+}
+
+func TestImagePrompter_PromptImageResult_nested(t *testing.T) {
+	inner := multi.NewImagePrompter(func() multi.Config {
+		return multi.Config{
+			Prompts:   []multi.WeightedPrompt{{Prompt: "caption", Weight: 1}},
+			Providers: []multi.WeightedProvider{{Provider: multi.Provider{Name: "inner", Prompter: &stubPrompter{text: "ok"}}, Weight: 1}},
+		}
+	})
+
+	cfg := multi.Config{
+		Prompts: []multi.WeightedPrompt{{Prompt: "caption", Weight: 1}},
+		Providers: []multi.WeightedProvider{
+			{Provider: multi.Provider{Name: "tier1", Prompter: inner}, Weight: 1},
+			{Provider: multi.Provider{Name: "tier2", Prompter: &stubPrompter{text: "tier2"}}, Weight: 1},
+		},
+	}
+
+	ip := multi.NewImagePrompter(func() multi.Config { return cfg })
+	ctx := multi.WithRouting(context.Background(), multi.Routing{Names: []string{"tier1"}})
+
+	for range 5 {
+		res, err := ip.PromptImageResult(ctx, "", bytes.NewReader(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.Provider != "tier1" || res.Text != "ok" {
+			t.Fatalf("result of tier1 expected, %+v received", res)
+		}
+	}
+}
+
+func TestImagePrompter_PromptImageResult_cache(t *testing.T) {
+	sp := &stubPrompter{text: "ok"}
+	cfg := multi.Config{
+		Prompts: []multi.WeightedPrompt{{Prompt: "caption", Weight: 1}},
+		Providers: []multi.WeightedProvider{
+			{Provider: multi.Provider{Prompter: sp, Breaker: multi.BreakerConfig{ConsecutiveFailures: 1}}, Weight: 1},
+		},
+	}
+
+	ip := multi.NewImagePrompter(func() multi.Config { return cfg })
+	ip.Cache = mapStore{}
+
+	res, err := ip.PromptImageResult(context.Background(), "", bytes.NewReader([]byte("a")))
+	if err != nil || res.Cached {
+		t.Fatalf("fresh result expected, %v %v received", res.Cached, err)
+	}
+
+	// Failure opens breaker.
+	sp.err = errors.New("failed")
+
+	if _, err := ip.PromptImageResult(context.Background(), "", bytes.NewReader([]byte("b"))); err == nil {
+		t.Fatal("error expected")
+	}
+
+	res, err = ip.PromptImageResult(context.Background(), "", bytes.NewReader([]byte("a")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !res.Cached || res.Text != "ok" || res.Provider != "custom" {
+		t.Fatalf("cached result expected, %+v received", res)
+	}
+}
+
+func TestImagePrompter_PromptImageResult_cacheEscalated(t *testing.T) {
+	weak := &stubPrompter{text: "weak", confidence: 0.1}
+	strong := &stubPrompter{text: "strong", confidence: 0.9}
+	cfg := multi.Config{
+		Prompts: []multi.WeightedPrompt{{Prompt: "caption", Weight: 1}},
+		Providers: []multi.WeightedProvider{
+			{Provider: multi.Provider{Name: "weak", Prompter: weak}, Weight: 1},
+			{Provider: multi.Provider{Name: "strong", Prompter: strong}},
+		},
+		Confidence: multi.ConfidenceConfig{Threshold: 0.5, Names: []string{"strong"}},
+	}
+
+	ip := multi.NewImagePrompter(func() multi.Config { return cfg })
+	ip.Cache = mapStore{}
+
+	for i := range 2 {
+		res, err := ip.PromptImageResult(context.Background(), "", bytes.NewReader([]byte("img")))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.Text != "strong" || !res.Escalated || res.Cached != (i == 1) {
+			t.Fatalf("escalated result expected, %+v received", res)
+		}
+	}
+
+	if weak.calls != 1 || strong.calls != 1 {
+		t.Fatalf("single call of each provider expected, %d %d received", weak.calls, strong.calls)
+	}
+}
+
+func TestImagePrompter_PromptImageResult_cacheRejected(t *testing.T) {
+	sp := &stubPrompter{text: "I'm sorry, I can't help with that."}
+	cfg := multi.Config{
+		Prompts:    []multi.WeightedPrompt{{Prompt: "caption", Weight: 1}},
+		Providers:  []multi.WeightedProvider{{Provider: multi.Provider{Prompter: sp}, Weight: 1}},
+		Validation: multi.ValidationConfig{Refusal: true, Retries: -1},
+	}
+
+	store := mapStore{}
+	ip := multi.NewImagePrompter(func() multi.Config { return cfg })
+	ip.Cache = store
+
+	for range 2 {
+		_, err := ip.PromptImageResult(context.Background(), "", bytes.NewReader([]byte("img")))
+
+		var ie multi.ErrInvalidOutput
+		if !errors.As(err, &ie) {
+			t.Fatalf("invalid output error expected, %v received", err)
+		}
+	}
+
+	if len(store) != 0 || sp.calls != 2 {
+		t.Fatalf("rejected output must not be cached, %d entries, %d calls", len(store), sp.calls)
+	}
+}
+
+func TestImagePrompter_ReportFeedback_restart(t *testing.T) {
+	dir := t.TempDir()
+	cfg := multi.Config{
+		Prompts:       []multi.WeightedPrompt{{Name: "p1", Prompt: "caption", Weight: 1}},
+		Providers:     []multi.WeightedProvider{{Provider: multi.Provider{Prompter: &stubPrompter{text: "ok"}}, Weight: 1}},
+		Bandit:        multi.BanditConfig{StateFile: filepath.Join(dir, "feedback.json")},
+		ExperimentLog: filepath.Join(dir, "experiments.jsonl"),
+	}
+
+	res, err := multi.NewImagePrompter(func() multi.Config { return cfg }).
+		PromptImageResult(context.Background(), "", bytes.NewReader(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// New instance does not track the result in memory.
+	ip := multi.NewImagePrompter(func() multi.Config { return cfg })
+
+	if err := ip.ReportFeedback(res.ID, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	var ue multi.ErrUnknownResult
+
+	if err := ip.ReportFeedback(res.ID, 1); !errors.As(err, &ue) {
+		t.Fatalf("unknown result error expected for repeated feedback, %v received", err)
+	}
+
+	if err := ip.ReportFeedback("unknown", 1); !errors.As(err, &ue) {
+		t.Fatalf("unknown result error expected, %v received", err)
+	}
+
+	prompts, providers, err := ip.Feedback()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if prompts["p1"].Count != 1 || providers["custom"].Count != 1 {
+		t.Fatalf("single feedback expected, %v %v received", prompts, providers)
+	}
+}
+
+func TestImagePrompter_shadow_state(t *testing.T) {
+	log := filepath.Join(t.TempDir(), "shadow.jsonl")
+	primary := &stubPrompter{text: "ok"}
+	cfg := multi.Config{
+		Prompts: []multi.WeightedPrompt{{Prompt: "caption", Weight: 1}},
+		Providers: []multi.WeightedProvider{
+			{Provider: multi.Provider{Name: "a", Prompter: primary, Concurrency: 3}, Weight: 1},
+		},
+		Shadow: multi.ShadowConfig{
+			Fraction:    1,
+			Concurrency: 1,
+			Log:         log,
+			// Shadow provider with the same ID as primary.
+			Providers: []multi.Provider{{Name: "a", Prompter: &stubPrompter{err: imageprompt.ErrResourceExhausted}}},
+		},
+	}
+
+	ip := multi.NewImagePrompter(func() multi.Config { return cfg })
+
+	for range 3 {
+		res, err := ip.PromptImageResult(context.Background(), "", bytes.NewReader(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ip.WaitShadow()
+
+		// Exhaustion of shadow provider does not take primary out of rotation.
+		if res.Provider != "a" || res.Text != "ok" {
+			t.Fatalf("primary result expected, %+v received", res)
+		}
+	}
+
+	if primary.calls != 3 {
+		t.Fatalf("3 primary calls expected, %d received", primary.calls)
+	}
+
+	// Primary limiter is not replaced by shadow limiter.
+	if limits := ip.ConcurrencyLimits(); limits["a"] != 3 || limits["shadow:a"] != 1 {
+		t.Fatalf("separate limits expected, %v received", limits)
+	}
+
+	if stats := ip.ProviderStats(); stats["a"].Requests != 3 || stats["a"].Failures != 0 {
+		t.Fatalf("unaffected primary stats expected, %+v received", stats["a"])
+	}
+
+	f, err := os.Open(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	var records []multi.ShadowRecord
+
+	for dec := json.NewDecoder(f); dec.More(); {
+		var r multi.ShadowRecord
+		if err := dec.Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+
+		records = append(records, r)
+	}
+
+	// Shadow is skipped while it is exhausted.
+	if len(records) != 1 {
+		t.Fatalf("single shadow record expected, %d received", len(records))
+	}
+
+	r := records[0]
+	if r.Primary.Text != "ok" || r.Shadow.Provider != "a" || !strings.Contains(r.Shadow.Error, "exhausted") {
+		t.Fatalf("unexpected shadow record: %+v", r)
+	}
+}
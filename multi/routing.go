@@ -0,0 +1,140 @@
+package multi
+
+import (
+	"context"
+	"slices"
+	"strings"
+)
+
+// Routing defines request-scoped overrides of prompt and provider selection.
+//
+// Empty fields do not restrict selection.
+type Routing struct {
+	// Types limits providers to the ones of listed types.
+	Types []ProviderType `json:"types,omitempty"`
+	// Tags limits providers to the ones having any of listed tags.
+	Tags []string `json:"tags,omitempty"`
+	// Names limits providers to the ones with listed names.
+	Names []string `json:"names,omitempty"`
+	// Exclude removes providers with listed names.
+	Exclude []string `json:"exclude,omitempty"`
+	// Prompt pins the prompt by name.
+	Prompt string `json:"prompt,omitempty"`
+	// Ensemble queries multiple providers and merges their captions, see Config.Ensemble.
+	Ensemble bool `json:"ensemble,omitempty"`
+}
+
+type routingCtxKey struct{}
+
+// WithRouting returns a context that carries routing overrides for ImagePrompter.
+func WithRouting(ctx context.Context, r Routing) context.Context {
+	return context.WithValue(ctx, routingCtxKey{}, r)
+}
+
+// RoutingFromContext returns routing overrides from context, if any.
+func RoutingFromContext(ctx context.Context) (Routing, bool) {
+	r, ok := ctx.Value(routingCtxKey{}).(Routing)
+
+	return r, ok
+}
+
+// withoutRouting hides routing overrides from a nested prompter, they only apply to providers of outer ImagePrompter.
+func withoutRouting(ctx context.Context) context.Context {
+	if _, ok := RoutingFromContext(ctx); !ok {
+		return ctx
+	}
+
+	return context.WithValue(ctx, routingCtxKey{}, nil)
+}
+
+// ErrNoMatchingProvider is returned when routing overrides exclude all configured providers.
+type ErrNoMatchingProvider struct {
+	Routing Routing
+}
+
+func (e ErrNoMatchingProvider) Error() string {
+	var conds []string
+
+	if len(e.Routing.Types) > 0 {
+		t := make([]string, 0, len(e.Routing.Types))
+		for _, pt := range e.Routing.Types {
+			t = append(t, string(pt))
+		}
+
+		conds = append(conds, "types "+strings.Join(t, ","))
+	}
+
+	if len(e.Routing.Tags) > 0 {
+		conds = append(conds, "tags "+strings.Join(e.Routing.Tags, ","))
+	}
+
+	if len(e.Routing.Names) > 0 {
+		conds = append(conds, "names "+strings.Join(e.Routing.Names, ","))
+	}
+
+	if len(e.Routing.Exclude) > 0 {
+		conds = append(conds, "excluding "+strings.Join(e.Routing.Exclude, ","))
+	}
+
+	return "no provider matches " + strings.Join(conds, ", ")
+}
+
+// ErrNoMatchingPrompt is returned when pinned prompt is not configured.
+type ErrNoMatchingPrompt struct {
+	Name string
+}
+
+func (e ErrNoMatchingPrompt) Error() string {
+	return "no prompt matches name " + e.Name
+}
+
+// ErrDuplicateProvider is returned when several configured providers have the same ID.
+//
+// Provider state, such as exhaustion and concurrency, is tracked by ID, so providers
+// of the same type and model need distinct names.
+type ErrDuplicateProvider struct {
+	ID string
+}
+
+func (e ErrDuplicateProvider) Error() string {
+	return "duplicate provider " + e.ID + ", set distinct names"
+}
+
+// checkUnique returns ErrDuplicateProvider if providers IDs are not unique.
+func checkUnique(providers []WeightedProvider) error {
+	seen := make(map[string]bool, len(providers))
+
+	for _, pr := range providers {
+		id := pr.Provider.ID()
+		if seen[id] {
+			return ErrDuplicateProvider{ID: id}
+		}
+
+		seen[id] = true
+	}
+
+	return nil
+}
+
+// matches checks if provider satisfies routing restrictions.
+func (r Routing) matches(p Provider) bool {
+	if len(r.Types) > 0 && !slices.Contains(r.Types, p.Type) {
+		return false
+	}
+
+	if len(r.Names) > 0 && !slices.Contains(r.Names, p.ID()) {
+		return false
+	}
+
+	if slices.Contains(r.Exclude, p.ID()) {
+		return false
+	}
+
+	if len(r.Tags) > 0 && !slices.ContainsFunc(r.Tags, func(t string) bool {
+		return slices.Contains(p.Tags, t)
+	}) {
+		return false
+	}
+
+	return true
+}
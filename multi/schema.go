@@ -0,0 +1,126 @@
+package multi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"unicode"
+
+	"github.com/swaggest/jsonschema-go"
+)
+
+// JSONSchema returns JSON Schema of Config.
+func JSONSchema() ([]byte, error) {
+	r := jsonschema.Reflector{}
+
+	s, err := r.Reflect(Config{},
+		jsonschema.InlineRefs,
+		jsonschema.InterceptProperty(func(_ string, _ reflect.StructField, propertySchema *jsonschema.Schema) error {
+			// Config uses minLength for both strings and lists.
+			if propertySchema.HasType(jsonschema.Array) && propertySchema.MinLength > 0 {
+				propertySchema.MinItems = propertySchema.MinLength
+				propertySchema.MinLength = 0
+			}
+
+			return nil
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(s, "", " ")
+}
+
+// JSONSchema describes Duration in JSON Schema.
+func (Duration) JSONSchema() (jsonschema.Schema, error) {
+	s := jsonschema.Schema{}
+	s.AddType(jsonschema.String)
+	s.AddType(jsonschema.Number)
+	s.WithExamples("30s", "1m30s", 30)
+	s.WithDescription("Duration, e.g. 30s or 1m30s, or a number of seconds.")
+
+	return s, nil
+}
+
+// Lint returns configuration problems that are not covered by Validate.
+func (c Config) Lint() []error {
+	var errs []error
+
+	if len(c.Prompts) > 0 {
+		total := 0
+		for _, p := range c.Prompts {
+			total += p.Weight
+		}
+
+		if total <= 0 {
+			errs = append(errs, errors.New("prompts: total weight is zero, no prompt can be picked"))
+		}
+	}
+
+	if len(c.Providers) > 0 {
+		total := 0
+		for _, p := range c.Providers {
+			total += p.Weight
+		}
+
+		if total <= 0 {
+			errs = append(errs, errors.New("providers: total weight is zero, no provider can be picked"))
+		}
+	}
+
+	switch c.PromptStrategy {
+	case "", StrategyWeighted, StrategyThompson, StrategyUCB:
+	default:
+		errs = append(errs, fmt.Errorf("prompt_strategy: unknown strategy %q, weighted is used", c.PromptStrategy))
+	}
+
+	switch c.Ensemble.Merge {
+	case "", MergeVote:
+	case MergeJudge:
+		if c.Ensemble.Judge.Type == "" {
+			errs = append(errs, errors.New("ensemble.judge: missing judge provider for judge merge"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("ensemble.merge: unknown merge method %q", c.Ensemble.Merge))
+	}
+
+	for i, p := range c.Validation.Patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			errs = append(errs, fmt.Errorf("validation.patterns[%d]: %w", i, err))
+		}
+	}
+
+	if c.Validation.Script != "" && unicode.Scripts[c.Validation.Script] == nil {
+		errs = append(errs, fmt.Errorf("validation.script: unknown Unicode script %q", c.Validation.Script))
+	}
+
+	for i, wp := range c.Providers {
+		p := wp.Provider
+		path := fmt.Sprintf("providers[%d].provider (%s)", i, p.ID())
+
+		if wp.Weight < 0 {
+			errs = append(errs, fmt.Errorf("%s: negative weight %d", path, wp.Weight))
+		}
+
+		switch p.Type {
+		case OpenAI, Gemini:
+			if len(p.authKeys()) == 0 {
+				errs = append(errs, fmt.Errorf("%s: missing auth_key for %s", path, p.Type))
+			}
+		case CloudFlare:
+			if p.BaseURL == "" {
+				errs = append(errs, fmt.Errorf("%s: missing base_url for %s", path, p.Type))
+			} else if u, err := url.Parse(p.BaseURL); err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid base_url: %w", path, err))
+			} else if u.User.Username() == "" {
+				errs = append(errs, fmt.Errorf("%s: missing auth key in base_url userinfo for %s", path, p.Type))
+			}
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,40 @@
+package multi
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfig_Lint(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		provider Provider
+		problems []string
+	}{
+		{name: "ollama", provider: Provider{Type: Ollama}},
+		{name: "custom", provider: Provider{Prompter: &textPrompter{}}},
+		{name: "missing auth key", provider: Provider{Type: OpenAI}, problems: []string{"missing auth_key for openai"}},
+		{name: "missing base url", provider: Provider{Type: CloudFlare}, problems: []string{"missing base_url for cloudflare"}},
+		{name: "unknown type is reported by Validate", provider: Provider{Type: "foo"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := Config{Providers: []WeightedProvider{{Provider: tc.provider, Weight: 1}}}
+
+			problems := cfg.Lint()
+			if len(problems) != len(tc.problems) {
+				t.Fatalf("%v expected, %v received", tc.problems, problems)
+			}
+
+			for i, p := range tc.problems {
+				if !strings.Contains(problems[i].Error(), p) {
+					t.Fatalf("%q expected, %v received", p, problems[i])
+				}
+			}
+		})
+	}
+
+	err := Config{Providers: []WeightedProvider{{Provider: Provider{Type: "foo"}, Weight: 1}}}.Validate()
+	if err == nil || !strings.Contains(err.Error(), "unexpected value foo") {
+		t.Fatalf("unknown provider type error expected, %v received", err)
+	}
+}
@@ -0,0 +1,116 @@
+package multi
+
+import (
+	"context"
+	"time"
+
+	"github.com/vearutop/image-prompt/imageprompt"
+)
+
+// ShadowOutput is an output of a provider.
+type ShadowOutput struct {
+	Provider     string        `json:"provider"`
+	Model        string        `json:"model,omitempty"`
+	Text         string        `json:"text,omitempty"`
+	Latency      time.Duration `json:"latency,omitempty"`
+	InputTokens  int           `json:"input_tokens,omitempty"`
+	OutputTokens int           `json:"output_tokens,omitempty"`
+	Cost         float64       `json:"cost,omitempty"`
+	Error        string        `json:"error,omitempty"`
+}
+
+// ShadowRecord is a line of shadow log, it compares shadow output with primary result.
+type ShadowRecord struct {
+	ID         string       `json:"id"` // Primary result ID.
+	Time       time.Time    `json:"time"`
+	PromptName string       `json:"prompt_name,omitempty"`
+	Prompt     string       `json:"prompt"`
+	Primary    ShadowOutput `json:"primary"`
+	Shadow     ShadowOutput `json:"shadow"`
+}
+
+func (c ShadowConfig) enabled() bool {
+	return c.Fraction > 0 && len(c.Providers) > 0
+}
+
+func shadowOutput(res Result, latency time.Duration) ShadowOutput {
+	return ShadowOutput{
+		Provider:     res.Provider,
+		Model:        res.Model,
+		Text:         res.Text,
+		Latency:      latency,
+		InputTokens:  res.Usage.InputTokens,
+		OutputTokens: res.Usage.OutputTokens,
+		Cost:         res.Cost,
+	}
+}
+
+// shadowState prefixes runtime state IDs of shadow providers.
+const shadowState = "shadow:"
+
+// shadow mirrors a fraction of successful requests to shadow providers in background.
+//
+// Shadow requests are skipped when shadow concurrency limit is reached or provider budget is exceeded.
+func (ip *ImagePrompter) shadow(ctx context.Context, cfg Config, p prompter, primary Result, img []byte) {
+	sc := cfg.Shadow
+	if !sc.enabled() || ip.float() >= sc.Fraction {
+		return
+	}
+
+	ip.shadowLimiter.configure(max(1, sc.Concurrency), AIMDConfig{})
+
+	// Shadow requests are not bound to the caller.
+	ctx = context.WithoutCancel(ctx)
+	now := time.Now()
+
+	for _, provider := range sc.Providers {
+		// Shadow requests have separate runtime state, so that they do not affect primary providers with the same ID.
+		state := shadowState + provider.ID()
+
+		if len(ip.availableKeys(state, provider)) == 0 || ip.overBudget(cfg, provider, now) {
+			continue
+		}
+
+		if !ip.shadowLimiter.tryAcquire() {
+			return
+		}
+
+		if bc := provider.Breaker; bc.enabled() && !ip.breaker(state).acquire(bc.withDefaults(), now) {
+			ip.shadowLimiter.release(0, nil)
+
+			continue
+		}
+
+		ip.shadowWG.Add(1)
+
+		go func() {
+			defer ip.shadowWG.Done()
+			defer ip.shadowLimiter.release(0, nil)
+
+			start := time.Now()
+			res, err := ip.do(ctx, cfg, ip.statePrompter(state, p.prompt, p.promptName, provider), img)
+
+			out := shadowOutput(res, time.Since(start))
+			out.Provider = provider.ID()
+
+			if err != nil {
+				out.Model = provider.modelName()
+				out.Error = imageprompt.RedactError(err).Error()
+			}
+
+			ip.reportError(ip.shadows.write(sc.Log, ShadowRecord{
+				ID:         primary.ID,
+				Time:       time.Now().UTC(),
+				PromptName: primary.PromptName,
+				Prompt:     primary.Prompt,
+				Primary:    shadowOutput(primary, primary.Latency),
+				Shadow:     out,
+			}))
+		}()
+	}
+}
+
+// WaitShadow waits for shadow requests in progress, for example before shutdown.
+func (ip *ImagePrompter) WaitShadow() {
+	ip.shadowWG.Wait()
+}
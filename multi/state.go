@@ -0,0 +1,80 @@
+package multi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// stateFile persists JSON state of a tracker, so that it survives restarts.
+//
+// A file that failed to load is never overwritten, so that a corrupted or unreadable file does not reset the state.
+type stateFile struct {
+	name    string
+	loaded  bool
+	loadErr error
+}
+
+// load reads file into v once, or again if file name is changed, reset must prepare empty state of v.
+func (s *stateFile) load(file string, v any, reset func()) error {
+	if s.loaded && s.name == file {
+		return nil
+	}
+
+	s.name = file
+	s.loaded = true
+	s.loadErr = nil
+
+	reset()
+
+	if file == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(file) //nolint:gosec // File name is provided by the user.
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		s.loadErr = err
+
+		return err
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		reset()
+
+		s.loadErr = fmt.Errorf("parse %s: %w", file, err)
+
+		return s.loadErr
+	}
+
+	return nil
+}
+
+// save writes v to the loaded file, it fails if the file could not be loaded.
+func (s *stateFile) save(v any) error {
+	if s.name == "" {
+		return nil
+	}
+
+	if s.loadErr != nil {
+		return fmt.Errorf("refusing to overwrite state file that failed to load: %w", s.loadErr)
+	}
+
+	data, err := json.MarshalIndent(v, "", " ")
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(filepath.Dir(s.name), "."+filepath.Base(s.name)+".tmp")
+
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.name)
+}
@@ -0,0 +1,60 @@
+package multi
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSpendTracker_add(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		content string // Empty for missing file.
+		loadErr bool
+		spent   float64
+		kept    bool // File content must be kept.
+	}{
+		{name: "missing", spent: 1},
+		{name: "existing", content: `{"days":{"2024-05-01":{"p":2}},"months":{"2024-05":{"p":2}}}`, spent: 3},
+		{name: "corrupt", content: `{"days":`, loadErr: true, spent: 1, kept: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "spend.json")
+
+			if tc.content != "" {
+				if err := os.WriteFile(file, []byte(tc.content), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+			var st spendTracker
+
+			err := st.add(file, "p", now, 1)
+			if (err != nil) != tc.loadErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// Following writes are refused too.
+			if err := st.add(file, "p", now, 0); (err != nil) != tc.loadErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			day, _, _ := st.spent(file, "p", now)
+			if day != tc.spent {
+				t.Fatalf("spend %v expected, %v received", tc.spent, day)
+			}
+
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if kept := string(data) == tc.content; kept != tc.kept {
+				t.Fatalf("file kept %v expected, %s received", tc.kept, data)
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package multi
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Routing strategies.
+const (
+	StrategyWeighted = "weighted" // Weighted random selection, default.
+	StrategyAdaptive = "adaptive" // Latency- and success-aware selection with weights as priors.
+)
+
+// Candidate is a provider available for routing.
+type Candidate struct {
+	Provider string        // Provider ID.
+	Weight   int           // Configured weight.
+	Stats    ProviderStats // Observed performance.
+	Feedback Feedback      // Accumulated feedback.
+}
+
+// Strategy selects a provider to serve a request.
+type Strategy interface {
+	// Pick returns index of selected candidate, or -1 if none can be selected.
+	Pick(candidates []Candidate) int
+}
+
+// StrategyFunc implements Strategy with a function.
+type StrategyFunc func(candidates []Candidate) int
+
+// Pick returns index of selected candidate.
+func (f StrategyFunc) Pick(candidates []Candidate) int {
+	return f(candidates)
+}
+
+// RegisterStrategy makes a custom strategy available by name in Config.Strategy.
+func (ip *ImagePrompter) RegisterStrategy(name string, s Strategy) {
+	ip.strategies.Store(name, s)
+}
+
+func (ip *ImagePrompter) strategy(cfg Config) Strategy {
+	switch cfg.Strategy {
+	case "", StrategyWeighted:
+	case StrategyAdaptive:
+		return adaptiveStrategy{cfg: cfg.Adaptive.withDefaults(), rnd: ip.float}
+	case StrategyThompson, StrategyUCB:
+		return banditStrategy{algo: cfg.Strategy, cfg: cfg.Bandit.withDefaults(), ip: ip}
+	default:
+		if s, ok := ip.strategies.Load(cfg.Strategy); ok {
+			return s
+		}
+	}
+
+	return StrategyFunc(func(candidates []Candidate) int {
+		weights := make([]int, len(candidates))
+		for i, c := range candidates {
+			weights[i] = c.Weight
+		}
+
+		return ip.pick(weights)
+	})
+}
+
+func (ip *ImagePrompter) float() float64 {
+	ip.rngMu.Lock()
+	defer ip.rngMu.Unlock()
+
+	return ip.rng.Float64()
+}
+
+func (c AdaptiveConfig) withDefaults() AdaptiveConfig {
+	if c.Alpha <= 0 || c.Alpha > 1 {
+		c.Alpha = 0.2
+	}
+
+	if c.Floor <= 0 || c.Floor > 1 {
+		c.Floor = 0.05
+	}
+
+	return c
+}
+
+// adaptiveStrategy scales configured weights by success rate and relative latency.
+type adaptiveStrategy struct {
+	cfg AdaptiveConfig
+	rnd func() float64
+}
+
+func (s adaptiveStrategy) Pick(candidates []Candidate) int {
+	fastest := time.Duration(math.MaxInt64)
+
+	for _, c := range candidates {
+		if c.Weight > 0 && c.Stats.Latency > 0 && c.Stats.Latency < fastest {
+			fastest = c.Stats.Latency
+		}
+	}
+
+	weights := make([]float64, len(candidates))
+	total := 0.0
+
+	for i, c := range candidates {
+		if c.Weight <= 0 {
+			continue
+		}
+
+		prior := float64(c.Weight)
+		w := prior
+
+		// Providers without observations keep their prior weight.
+		if c.Stats.Requests > 0 {
+			w *= c.Stats.SuccessRate * c.Stats.SuccessRate
+
+			if c.Stats.Latency > 0 {
+				w *= float64(fastest) / float64(c.Stats.Latency)
+			}
+		}
+
+		weights[i] = max(w, prior*s.cfg.Floor)
+		total += weights[i]
+	}
+
+	if total <= 0 {
+		return -1
+	}
+
+	r := s.rnd() * total
+
+	for i, w := range weights {
+		if w <= 0 {
+			continue
+		}
+
+		r -= w
+		if r < 0 {
+			return i
+		}
+	}
+
+	// Rounding fallback.
+	for i := len(weights) - 1; i >= 0; i-- {
+		if weights[i] > 0 {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// ProviderStats describes observed performance of a provider.
+type ProviderStats struct {
+	Requests    int64         `json:"requests"`
+	Failures    int64         `json:"failures"`
+	Latency     time.Duration `json:"latency"`      // EWMA of successful request latency.
+	SuccessRate float64       `json:"success_rate"` // EWMA of success, from 0 to 1.
+	Cost        float64       `json:"cost"`         // EWMA of successful request cost.
+}
+
+// latencySamples is a number of recent latencies kept for percentiles.
+const latencySamples = 100
+
+type stats struct {
+	mu sync.Mutex
+	ProviderStats
+
+	latencies []time.Duration // Ring buffer of recent successful latencies.
+	next      int
+}
+
+// percentile returns latency percentile (0 < q < 1) of recent requests, or 0 if there are less than minSamples.
+func (s *stats) percentile(q float64, minSamples int) time.Duration {
+	s.mu.Lock()
+	l := slices.Clone(s.latencies)
+	s.mu.Unlock()
+
+	if len(l) == 0 || len(l) < minSamples {
+		return 0
+	}
+
+	slices.Sort(l)
+
+	i := int(math.Ceil(q*float64(len(l)))) - 1
+
+	return l[max(0, min(i, len(l)-1))]
+}
+
+func (s *stats) observe(alpha float64, latency time.Duration, failed bool, cost float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	success := 1.0
+	if failed {
+		success = 0
+		s.Failures++
+	}
+
+	if s.Requests == 0 {
+		s.SuccessRate = success
+	} else {
+		s.SuccessRate += alpha * (success - s.SuccessRate)
+	}
+
+	s.Requests++
+
+	if failed {
+		return
+	}
+
+	if len(s.latencies) < latencySamples {
+		s.latencies = append(s.latencies, latency)
+	} else {
+		s.latencies[s.next] = latency
+		s.next = (s.next + 1) % latencySamples
+	}
+
+	if s.Latency == 0 {
+		s.Latency = latency
+		s.Cost = cost
+	} else {
+		s.Latency += time.Duration(alpha * float64(latency-s.Latency))
+		s.Cost += alpha * (cost - s.Cost)
+	}
+}
+
+func (s *stats) snapshot() ProviderStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.ProviderStats
+}
+
+func (ip *ImagePrompter) stats(id string) *stats {
+	s, _ := ip.providerStats.LoadOrStore(id, &stats{})
+
+	return s
+}
+
+// ProviderStats returns observed performance by provider ID.
+func (ip *ImagePrompter) ProviderStats() map[string]ProviderStats {
+	res := map[string]ProviderStats{}
+
+	ip.providerStats.Range(func(id string, s *stats) bool {
+		res[id] = s.snapshot()
+
+		return true
+	})
+
+	return res
+}
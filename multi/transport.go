@@ -0,0 +1,187 @@
+package multi
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/vearutop/image-prompt/imageprompt"
+	"github.com/vearutop/image-prompt/retry"
+)
+
+const defaultTimeout = 5 * time.Minute
+
+// timeout returns configured request timeout or default.
+func (s HTTPSettings) timeout() time.Duration {
+	if s.Timeout <= 0 {
+		return defaultTimeout
+	}
+
+	return time.Duration(s.Timeout)
+}
+
+// transport creates HTTP transport for settings.
+func (s HTTPSettings) transport() (http.RoundTripper, error) {
+	tr := http.DefaultTransport.(*http.Transport).Clone() //nolint:errcheck // Default transport is *http.Transport.
+
+	if s.ProxyURL != "" {
+		u, err := url.Parse(s.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("parse proxy url: %w", err)
+		}
+
+		tr.Proxy = http.ProxyURL(u)
+	}
+
+	if s.CABundle != "" || s.InsecureSkipVerify {
+		tlsConfig := &tls.Config{
+			MinVersion:         tls.VersionTLS12,
+			InsecureSkipVerify: s.InsecureSkipVerify, //nolint:gosec // Explicitly configured for lab hosts.
+		}
+
+		if s.CABundle != "" {
+			pem, err := os.ReadFile(s.CABundle)
+			if err != nil {
+				return nil, fmt.Errorf("read CA bundle: %w", err)
+			}
+
+			pool, err := x509.SystemCertPool()
+			if err != nil {
+				pool = x509.NewCertPool()
+			}
+
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, errors.New("no certificates found in CA bundle " + s.CABundle)
+			}
+
+			tlsConfig.RootCAs = pool
+		}
+
+		tr.TLSClientConfig = tlsConfig
+	}
+
+	if len(s.Headers) == 0 {
+		return tr, nil
+	}
+
+	return headerTransport{headers: s.Headers, next: tr}, nil
+}
+
+// headerTransport adds headers to requests.
+type headerTransport struct {
+	headers map[string]string
+	next    http.RoundTripper
+}
+
+func (t headerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+
+	for k, v := range t.headers {
+		r.Header.Set(k, v)
+	}
+
+	return t.next.RoundTrip(r)
+}
+
+func (t headerTransport) CloseIdleConnections() {
+	if c, ok := t.next.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// fingerprint returns a hash of JSON representation of a value to detect changes.
+func fingerprint(v any) string {
+	j, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+
+	h := sha256.Sum256(j)
+
+	return hex.EncodeToString(h[:])
+}
+
+type cachedTransport struct {
+	fingerprint string
+	transport   http.RoundTripper
+}
+
+// transport returns shared transport of a provider state, transport is recreated when settings change.
+//
+// Transports are keyed by state ID, so that shadow and primary providers with the same ID do not replace each other.
+func (ip *ImagePrompter) transport(state string, p Provider) (http.RoundTripper, error) {
+	fp := fingerprint(p.HTTP)
+
+	if ct, ok := ip.transports.Load(state); ok && ct.fingerprint == fp {
+		return ct.transport, nil
+	}
+
+	tr, err := p.HTTP.transport()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", p.ID(), err)
+	}
+
+	if ct, loaded := ip.transports.LoadOrStore(state, cachedTransport{fingerprint: fp, transport: tr}); loaded {
+		if ct.fingerprint == fp {
+			return ct.transport, nil
+		}
+
+		if t, ok := ct.transport.(interface{ CloseIdleConnections() }); ok {
+			t.CloseIdleConnections()
+		}
+
+		ip.transports.Store(state, cachedTransport{fingerprint: fp, transport: tr})
+	}
+
+	return tr, nil
+}
+
+type cachedPrompter struct {
+	fingerprint string
+	prompter    imageprompt.Prompter
+}
+
+// driver returns reusable prompter for a resolved provider state and auth key.
+func (ip *ImagePrompter) driver(state string, p Provider, keyIndex int) (imageprompt.Prompter, error) {
+	if p.Prompter != nil {
+		return p.Prompter, nil
+	}
+
+	k := keyID(state, keyIndex)
+	fp := fingerprint(p)
+
+	if cp, ok := ip.prompters.Load(k); ok && cp.fingerprint == fp {
+		return cp.prompter, nil
+	}
+
+	tr, err := ip.transport(state, p)
+	if err != nil {
+		return nil, err
+	}
+
+	pr, err := p.prompter(tr)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Retry.Attempts > 1 {
+		pr = retry.New(pr, retry.Policy{
+			Attempts:   p.Retry.Attempts,
+			Backoff:    time.Duration(p.Retry.Backoff),
+			MaxBackoff: time.Duration(p.Retry.MaxBackoff),
+			Jitter:     p.Retry.Jitter,
+		})
+	}
+
+	ip.prompters.Store(k, cachedPrompter{fingerprint: fp, prompter: pr})
+
+	return pr, nil
+}
@@ -0,0 +1,59 @@
+package multi
+
+import (
+	"testing"
+	"time"
+)
+
+func TestImagePrompter_driver_state(t *testing.T) {
+	ip := NewImagePrompter(func() Config { return Config{} })
+
+	primary := Provider{Name: "a", Type: Ollama, Model: "llava:13b"}
+	shadow := Provider{Name: "a", Type: Ollama, Model: "llava:34b", HTTP: HTTPSettings{Timeout: Duration(time.Minute)}}
+
+	p1, err := ip.driver("a", primary, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t1, err := ip.transport("a", primary)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Shadow provider with the same ID and different settings has its own driver and transport.
+	s, err := ip.driver(shadowState+"a", shadow, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s == p1 || s.ModelName() != "llava:34b" {
+		t.Fatalf("separate shadow driver expected, %s received", s.ModelName())
+	}
+
+	p2, err := ip.driver("a", primary, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t2, err := ip.transport("a", primary)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p2 != p1 || t2 != t1 {
+		t.Fatal("primary driver and transport must be reused")
+	}
+
+	// Changed settings recreate driver.
+	primary.Model = "llava:7b"
+
+	p3, err := ip.driver("a", primary, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p3 == p1 || p3.ModelName() != "llava:7b" {
+		t.Fatalf("new driver expected, %s received", p3.ModelName())
+	}
+}
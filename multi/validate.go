@@ -0,0 +1,187 @@
+package multi
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// defaultRefusals are patterns of common refusals, enabled with ValidationConfig.Refusal.
+var defaultRefusals = []string{
+	`(?i)\bI(?:'m| am) (?:sorry|unable|not able)\b`,
+	`(?i)\bI (?:can(?:not|'t)|won't) (?:help|assist|provide|describe|identify|comply)\b`,
+	`(?i)\bas an AI\b`,
+}
+
+// Validator checks output of a provider, it returns an error that explains rejection.
+type Validator interface {
+	Validate(res Result) error
+}
+
+// ValidatorFunc implements Validator with a function.
+type ValidatorFunc func(res Result) error
+
+// Validate checks output of a provider.
+func (f ValidatorFunc) Validate(res Result) error {
+	return f(res)
+}
+
+// Validation is a verdict of output validation.
+type Validation struct {
+	Passed     bool        `json:"passed"`
+	Rejections []Rejection `json:"rejections,omitempty"` // Outputs rejected before this one.
+}
+
+// Rejection describes rejected output.
+type Rejection struct {
+	Provider   string `json:"provider"`
+	PromptName string `json:"prompt_name,omitempty"`
+	Text       string `json:"text"`
+	Reason     string `json:"reason"`
+}
+
+// ErrInvalidOutput is returned when outputs of all attempts are rejected by validation.
+type ErrInvalidOutput struct {
+	Reason string
+}
+
+func (e ErrInvalidOutput) Error() string {
+	return "invalid output: " + e.Reason
+}
+
+func (c ValidationConfig) enabled() bool {
+	return c.Refusal || len(c.Patterns) > 0 || c.MinLength > 0 || c.MaxLength > 0 || c.Script != "" || c.PromptEcho
+}
+
+func (c ValidationConfig) retries() int {
+	if c.Retries < 0 {
+		return 0
+	}
+
+	if c.Retries == 0 {
+		return 2
+	}
+
+	return c.Retries
+}
+
+// validate checks result with configured rules and custom Validator.
+func (ip *ImagePrompter) validate(cfg ValidationConfig, res Result) error {
+	if !cfg.enabled() && ip.Validator == nil {
+		return nil
+	}
+
+	var errs []error
+
+	if cfg.enabled() {
+		text := strings.TrimSpace(res.Text)
+		length := len([]rune(text))
+
+		if length == 0 {
+			errs = append(errs, errors.New("empty output"))
+		}
+
+		if cfg.MinLength > 0 && length < cfg.MinLength {
+			errs = append(errs, fmt.Errorf("output is shorter than %d characters", cfg.MinLength))
+		}
+
+		if cfg.MaxLength > 0 && length > cfg.MaxLength {
+			errs = append(errs, fmt.Errorf("output is longer than %d characters", cfg.MaxLength))
+		}
+
+		patterns := cfg.Patterns
+		if cfg.Refusal {
+			patterns = append(defaultRefusals[:len(defaultRefusals):len(defaultRefusals)], patterns...)
+		}
+
+		for _, p := range patterns {
+			re, err := ip.regexp(p)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid pattern %q: %w", p, err))
+
+				continue
+			}
+
+			if re.MatchString(text) {
+				errs = append(errs, fmt.Errorf("output matches %q", p))
+
+				break
+			}
+		}
+
+		if cfg.Script != "" && length > 0 {
+			if err := checkScript(text, cfg.Script); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		if cfg.PromptEcho && res.Prompt != "" && echoes(text, res.Prompt) {
+			errs = append(errs, errors.New("output echoes the prompt"))
+		}
+	}
+
+	if ip.Validator != nil {
+		if err := ip.Validator.Validate(res); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (ip *ImagePrompter) regexp(pattern string) (*regexp.Regexp, error) {
+	if re, ok := ip.patterns.Load(pattern); ok {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	ip.patterns.Store(pattern, re)
+
+	return re, nil
+}
+
+// checkScript checks that most of letters belong to expected Unicode script, e.g. Latin.
+func checkScript(text, script string) error {
+	table, ok := unicode.Scripts[script]
+	if !ok {
+		return fmt.Errorf("unknown script %q", script)
+	}
+
+	letters, matched := 0, 0
+
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+
+		letters++
+
+		if unicode.Is(table, r) {
+			matched++
+		}
+	}
+
+	if letters > 0 && float64(matched)/float64(letters) < 0.7 {
+		return fmt.Errorf("output is not in %s script", script)
+	}
+
+	return nil
+}
+
+// echoes checks if text repeats the prompt instead of answering it.
+func echoes(text, prompt string) bool {
+	t := strings.ToLower(strings.TrimSpace(text))
+	p := strings.ToLower(strings.TrimSpace(prompt))
+
+	if strings.HasPrefix(t, p) {
+		return true
+	}
+
+	return jaccard(words(t), words(p)) >= 0.8
+}
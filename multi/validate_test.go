@@ -0,0 +1,251 @@
+package multi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// textPrompter responds with fixed text and counts calls.
+type textPrompter struct {
+	text  string
+	calls int
+}
+
+func (p *textPrompter) PromptImage(_ context.Context, _ string, _ io.Reader) (string, error) {
+	p.calls++
+
+	return p.text, nil
+}
+
+func (p *textPrompter) ModelName() string {
+	return "text"
+}
+
+func TestImagePrompter_validate(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		cfg       ValidationConfig
+		validator Validator
+		text      string
+		prompt    string
+		err       string // Expected part of error message, empty if output is valid.
+	}{
+		{name: "disabled", text: ""},
+		{name: "valid", cfg: ValidationConfig{Refusal: true, MinLength: 5}, text: "A dog on a beach."},
+		{name: "empty", cfg: ValidationConfig{Refusal: true}, text: "  \n", err: "empty output"},
+		{name: "refusal", cfg: ValidationConfig{Refusal: true}, text: "I'm sorry, I can't help with that.", err: "output matches"},
+		{name: "cannot describe", cfg: ValidationConfig{Refusal: true}, text: "I cannot identify people.", err: "output matches"},
+		{name: "as an AI", cfg: ValidationConfig{Refusal: true}, text: "As an AI model, I see a dog.", err: "output matches"},
+		{name: "refusal disabled", cfg: ValidationConfig{MinLength: 1}, text: "I'm sorry, I can't help with that."},
+		{name: "pattern", cfg: ValidationConfig{Patterns: []string{`(?i)^here is`}}, text: "Here is a caption: a dog.", err: `output matches "(?i)^here is"`},
+		{name: "pattern not matched", cfg: ValidationConfig{Patterns: []string{`(?i)^here is`}}, text: "A dog, here is its ball."},
+		{name: "invalid pattern", cfg: ValidationConfig{Patterns: []string{`(`}}, text: "A dog.", err: "invalid pattern"},
+		{name: "too short", cfg: ValidationConfig{MinLength: 10}, text: "A dog.", err: "shorter than 10 characters"},
+		{name: "min length in runes", cfg: ValidationConfig{MinLength: 4}, text: "Собака"},
+		{name: "too long", cfg: ValidationConfig{MaxLength: 5}, text: "A dog on a beach.", err: "longer than 5 characters"},
+		{name: "max length trims spaces", cfg: ValidationConfig{MaxLength: 6}, text: " A dog. \n"},
+		{name: "script", cfg: ValidationConfig{Script: "Latin"}, text: "Собака на пляже.", err: "not in Latin script"},
+		{name: "prompt echo", cfg: ValidationConfig{PromptEcho: true}, prompt: "Describe this image.", text: "Describe this image. A dog.", err: "echoes the prompt"},
+		{name: "no prompt echo", cfg: ValidationConfig{PromptEcho: true}, prompt: "Describe this image.", text: "A dog on a beach."},
+		{
+			name:      "custom validator",
+			validator: ValidatorFunc(func(res Result) error { return errors.New("custom: " + res.Text) }),
+			text:      "A dog.",
+			err:       "custom: A dog.",
+		},
+		{
+			name:      "all errors",
+			cfg:       ValidationConfig{MinLength: 10, Patterns: []string{`dog`}},
+			validator: ValidatorFunc(func(_ Result) error { return errors.New("custom") }),
+			text:      "A dog.",
+			err:       "shorter than 10 characters\noutput matches \"dog\"\ncustom",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ip := NewImagePrompter(func() Config { return Config{} })
+			ip.Validator = tc.validator
+
+			err := ip.validate(tc.cfg, Result{Text: tc.text, Prompt: tc.prompt})
+			if tc.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("error %q expected, %v received", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestCheckScript(t *testing.T) {
+	for _, tc := range []struct {
+		text   string
+		script string
+		err    string
+	}{
+		{text: "A dog on a beach.", script: "Latin"},
+		{text: "Собака на пляже.", script: "Cyrillic"},
+		{text: "Собака на пляже.", script: "Latin", err: "output is not in Latin script"},
+		{text: "Собака на пляже, снято на Canon.", script: "Cyrillic"}, // Few foreign words are fine.
+		{text: "Dog, Canon EOS, собака.", script: "Cyrillic", err: "output is not in Cyrillic script"},
+		{text: "1, 2, 3!", script: "Han"}, // No letters.
+		{text: "A dog.", script: "Klingon", err: `unknown script "Klingon"`},
+	} {
+		t.Run(tc.text+" "+tc.script, func(t *testing.T) {
+			err := checkScript(tc.text, tc.script)
+			if (err == nil) != (tc.err == "") || (err != nil && err.Error() != tc.err) {
+				t.Fatalf("%q expected, %v received", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestEchoes(t *testing.T) {
+	for _, tc := range []struct {
+		text   string
+		prompt string
+		want   bool
+	}{
+		{text: "Describe this image in one sentence.", prompt: "Describe this image in one sentence.", want: true},
+		{text: "  describe THIS image in one sentence: a dog", prompt: "Describe this image in one sentence", want: true},
+		{text: "Image: describe this in one sentence", prompt: "Describe this image in one sentence.", want: true},
+		{text: "A dog on a beach.", prompt: "Describe this image in one sentence.", want: false},
+		{text: "This image shows a dog in one sentence.", prompt: "Describe this image in one sentence.", want: false},
+	} {
+		t.Run(tc.text, func(t *testing.T) {
+			if got := echoes(tc.text, tc.prompt); got != tc.want {
+				t.Fatalf("%v expected, %v received", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestImagePrompter_result_validation(t *testing.T) {
+	const refusal = "I'm sorry, I can't help with that."
+
+	for _, tc := range []struct {
+		name      string
+		texts     []string // Outputs of providers p0, p1, ... that are picked in order.
+		retries   int
+		provider  string
+		text      string
+		rejected  []string // Providers of rejected outputs.
+		invalid   bool
+		calls     []int
+		exclusion []string // Routing exclusions.
+	}{
+		{
+			name:     "valid",
+			texts:    []string{"A dog.", "A cat."},
+			provider: "p0",
+			text:     "A dog.",
+			calls:    []int{1, 0},
+		},
+		{
+			name:     "retried on another provider",
+			texts:    []string{refusal, refusal, "A dog."},
+			provider: "p2",
+			text:     "A dog.",
+			rejected: []string{"p0", "p1"},
+			calls:    []int{1, 1, 1},
+		},
+		{
+			name:     "retries exhausted",
+			texts:    []string{refusal, refusal, "A dog."},
+			retries:  1,
+			provider: "p1",
+			text:     refusal,
+			rejected: []string{"p0", "p1"},
+			invalid:  true,
+			calls:    []int{1, 1, 0},
+		},
+		{
+			name:     "retries disabled",
+			texts:    []string{refusal, "A dog."},
+			retries:  -1,
+			provider: "p0",
+			text:     refusal,
+			rejected: []string{"p0"},
+			invalid:  true,
+			calls:    []int{1, 0},
+		},
+		{
+			name:     "providers exhausted",
+			texts:    []string{refusal, refusal},
+			retries:  5,
+			provider: "p1",
+			text:     refusal,
+			rejected: []string{"p0", "p1"},
+			invalid:  true,
+			calls:    []int{1, 1},
+		},
+		{
+			name:      "routing exclusions are kept",
+			texts:     []string{"A dog.", refusal, "A cat."},
+			exclusion: []string{"p0"},
+			provider:  "p2",
+			text:      "A cat.",
+			rejected:  []string{"p1"},
+			calls:     []int{0, 1, 1},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := Config{
+				Prompts:    []WeightedPrompt{{Prompt: "caption", Weight: 1}},
+				Strategy:   "first",
+				Validation: ValidationConfig{Refusal: true, Retries: tc.retries},
+			}
+
+			prompters := make([]*textPrompter, len(tc.texts))
+
+			for i, text := range tc.texts {
+				prompters[i] = &textPrompter{text: text}
+				cfg.Providers = append(cfg.Providers, WeightedProvider{
+					Provider: Provider{Name: "p" + strconv.Itoa(i), Prompter: prompters[i]},
+					Weight:   1,
+				})
+			}
+
+			ip := NewImagePrompter(func() Config { return cfg })
+			ip.RegisterStrategy("first", StrategyFunc(func(_ []Candidate) int { return 0 }))
+
+			ctx := WithRouting(context.Background(), Routing{Exclude: tc.exclusion})
+
+			res, err := ip.PromptImageResult(ctx, "", bytes.NewReader(nil))
+
+			var ie ErrInvalidOutput
+			if errors.As(err, &ie) != tc.invalid || (!tc.invalid && err != nil) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if res.Provider != tc.provider || res.Text != tc.text {
+				t.Fatalf("%s of %s expected, %q of %s received", tc.text, tc.provider, res.Text, res.Provider)
+			}
+
+			if res.Validation == nil || res.Validation.Passed == tc.invalid || len(res.Validation.Rejections) != len(tc.rejected) {
+				t.Fatalf("unexpected validation: %+v", res.Validation)
+			}
+
+			for i, r := range res.Validation.Rejections {
+				if r.Provider != tc.rejected[i] || r.Text != refusal || r.Reason == "" {
+					t.Fatalf("unexpected rejection %d: %+v", i, r)
+				}
+			}
+
+			for i, p := range prompters {
+				if p.calls != tc.calls[i] {
+					t.Fatalf("p%d: %d calls expected, %d received", i, tc.calls[i], p.calls)
+				}
+			}
+		})
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"io"
 	"net/http"
 	"strings"
+
+	"github.com/vearutop/image-prompt/imageprompt"
 )
 
 // ImagePrompter can ask LLM about an image.
@@ -27,17 +29,46 @@ func (ip *ImagePrompter) ModelName() string {
 }
 
 // PromptImage asks LLM about JPEG image.
+//
+// Returned errors are redacted with imageprompt.RedactError.
 func (ip *ImagePrompter) PromptImage(ctx context.Context, prompt string, jpegImage io.Reader) (string, error) {
-	type Req struct {
-		Model  string   `json:"model"`
-		Prompt string   `json:"prompt"`
-		Stream bool     `json:"stream"`
-		Images [][]byte `json:"images"`
-	}
+	res, err := ip.PromptImageResponse(ctx, prompt, jpegImage)
+
+	return res.Text, err
+}
 
-	cont, err := io.ReadAll(jpegImage)
+// PromptImageResponse asks LLM about JPEG image and returns detailed response.
+//
+// Returned errors are redacted with imageprompt.RedactError.
+func (ip *ImagePrompter) PromptImageResponse(ctx context.Context, prompt string, jpegImage io.Reader) (imageprompt.Response, error) {
+	res, err := ip.promptImage(ctx, prompt, jpegImage)
+
+	return res, imageprompt.RedactError(err)
+}
+
+func (ip *ImagePrompter) promptImage(ctx context.Context, prompt string, jpegImage io.Reader) (imageprompt.Response, error) {
+	img, err := io.ReadAll(jpegImage)
 	if err != nil {
-		return "", err
+		return imageprompt.Response{}, err
+	}
+
+	// Ollama has no native alternatives, they are generated with different seeds.
+	return imageprompt.PromptAlternatives(imageprompt.OptionsFromContext(ctx).N, func(seed int) (imageprompt.Response, error) {
+		return ip.generate(ctx, prompt, img, seed)
+	})
+}
+
+func (ip *ImagePrompter) generate(ctx context.Context, prompt string, cont []byte, seed int) (imageprompt.Response, error) {
+	type Options struct {
+		Seed int `json:"seed,omitempty"`
+	}
+
+	type Req struct {
+		Model   string   `json:"model"`
+		Prompt  string   `json:"prompt"`
+		Stream  bool     `json:"stream"`
+		Images  [][]byte `json:"images"`
+		Options *Options `json:"options,omitempty"`
 	}
 
 	r := Req{}
@@ -47,13 +78,17 @@ func (ip *ImagePrompter) PromptImage(ctx context.Context, prompt string, jpegIma
 	r.Stream = false
 	r.Images = append(r.Images, cont)
 
+	if seed != 0 {
+		r.Options = &Options{Seed: seed}
+	}
+
 	if r.Model == "" {
 		r.Model = "llava:7b"
 	}
 
 	body, err := json.Marshal(r)
 	if err != nil {
-		return "", err
+		return imageprompt.Response{}, err
 	}
 
 	baseURL := ip.BaseURL
@@ -63,7 +98,7 @@ func (ip *ImagePrompter) PromptImage(ctx context.Context, prompt string, jpegIma
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL, bytes.NewReader(body))
 	if err != nil {
-		return "", err
+		return imageprompt.Response{}, err
 	}
 
 	tr := ip.Transport
@@ -73,25 +108,41 @@ func (ip *ImagePrompter) PromptImage(ctx context.Context, prompt string, jpegIma
 
 	resp, err := tr.RoundTrip(req)
 	if err != nil {
-		return "", err
+		return imageprompt.Response{}, err
 	}
 
 	defer resp.Body.Close() //nolint:errcheck
 
 	cont, err = io.ReadAll(resp.Body)
 	if err != nil {
-		return "", err
+		return imageprompt.Response{}, err
+	}
+
+	if err := imageprompt.CheckStatus(resp, cont); err != nil {
+		return imageprompt.Response{}, err
 	}
 
 	type Resp struct {
-		Response string `json:"response"`
+		Response        string `json:"response"`
+		DoneReason      string `json:"done_reason"`
+		PromptEvalCount int    `json:"prompt_eval_count"`
+		EvalCount       int    `json:"eval_count"`
 	}
 
 	re := Resp{}
 
 	if err := json.Unmarshal(cont, &re); err != nil {
-		return "", err
+		return imageprompt.Response{}, err
 	}
 
-	return strings.Trim(re.Response, `" \t`), nil
+	text := strings.Trim(re.Response, `" \t`)
+
+	return imageprompt.Response{
+		Text: text,
+		Usage: imageprompt.Usage{
+			InputTokens:  re.PromptEvalCount,
+			OutputTokens: re.EvalCount,
+		},
+		Alternatives: []imageprompt.Alternative{{Text: text, FinishReason: re.DoneReason}},
+	}, nil
 }
@@ -10,6 +10,8 @@ import (
 	"io"
 	"net/http"
 	"strings"
+
+	"github.com/vearutop/image-prompt/imageprompt"
 )
 
 // ImagePrompter can ask LLM about an image.
@@ -29,10 +31,29 @@ func (ip *ImagePrompter) ModelName() string {
 }
 
 // PromptImage asks LLM about JPEG image.
+//
+// Returned errors are redacted with imageprompt.RedactError.
 func (ip *ImagePrompter) PromptImage(ctx context.Context, prompt string, jpegImage io.Reader) (string, error) {
+	res, err := ip.PromptImageResponse(ctx, prompt, jpegImage)
+
+	return res.Text, err
+}
+
+// PromptImageResponse asks LLM about JPEG image and returns detailed response.
+//
+// Returned errors are redacted with imageprompt.RedactError.
+func (ip *ImagePrompter) PromptImageResponse(ctx context.Context, prompt string, jpegImage io.Reader) (imageprompt.Response, error) {
+	imageprompt.RegisterSecret(ip.AuthKey)
+
+	res, err := ip.promptImage(ctx, prompt, jpegImage)
+
+	return res, imageprompt.RedactError(err)
+}
+
+func (ip *ImagePrompter) promptImage(ctx context.Context, prompt string, jpegImage io.Reader) (imageprompt.Response, error) {
 	img, err := io.ReadAll(jpegImage)
 	if err != nil {
-		return "", err
+		return imageprompt.Response{}, err
 	}
 
 	type ImageURL struct {
@@ -54,6 +75,8 @@ func (ip *ImagePrompter) PromptImage(ctx context.Context, prompt string, jpegIma
 		Model     string    `json:"model"`
 		Messages  []Message `json:"messages"`
 		MaxTokens int       `json:"max_tokens"`
+		N         int       `json:"n,omitempty"`
+		Logprobs  bool      `json:"logprobs,omitempty"`
 	}
 
 	type Response struct {
@@ -69,8 +92,13 @@ func (ip *ImagePrompter) PromptImage(ctx context.Context, prompt string, jpegIma
 				Refusal     interface{}   `json:"refusal"`
 				Annotations []interface{} `json:"annotations"`
 			} `json:"message"`
-			Logprobs     interface{} `json:"logprobs"`
-			FinishReason string      `json:"finish_reason"`
+			Logprobs *struct {
+				Content []struct {
+					Token   string  `json:"token"`
+					Logprob float64 `json:"logprob"`
+				} `json:"content"`
+			} `json:"logprobs"`
+			FinishReason string `json:"finish_reason"`
 		} `json:"choices"`
 		Usage struct {
 			PromptTokens        int `json:"prompt_tokens"`
@@ -111,18 +139,26 @@ func (ip *ImagePrompter) PromptImage(ctx context.Context, prompt string, jpegIma
 	})
 	req.MaxTokens = 300
 
+	opts := imageprompt.OptionsFromContext(ctx)
+
+	if opts.N > 1 {
+		req.N = opts.N
+	}
+
+	req.Logprobs = opts.Confidence || opts.Logprobs
+
 	if req.Model == "" {
 		req.Model = "gpt-4o-mini"
 	}
 
 	body, err := json.Marshal(req)
 	if err != nil {
-		return "", err
+		return imageprompt.Response{}, err
 	}
 
 	r, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.openai.com/v1/chat/completions", bytes.NewReader(body))
 	if err != nil {
-		return "", err
+		return imageprompt.Response{}, err
 	}
 
 	r.Header.Set("Content-Type", "application/json")
@@ -135,29 +171,74 @@ func (ip *ImagePrompter) PromptImage(ctx context.Context, prompt string, jpegIma
 
 	resp, err := tr.RoundTrip(r)
 	if err != nil {
-		return "", err
+		return imageprompt.Response{}, err
 	}
 
 	defer resp.Body.Close() //nolint:errcheck
 
 	cont, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", err
+		return imageprompt.Response{}, err
 	}
 
 	re := Response{}
 
 	if err := json.Unmarshal(cont, &re); err != nil {
-		return "", err
+		if err := imageprompt.CheckStatus(resp, cont); err != nil {
+			return imageprompt.Response{}, err
+		}
+
+		return imageprompt.Response{}, err
 	}
 
 	if re.Error.Message != "" {
-		return "", errors.New(re.Error.Message)
+		return imageprompt.Response{}, imageprompt.ErrUnexpectedResponse{
+			Message:      re.Error.Message,
+			StatusCode:   resp.StatusCode,
+			ResponseBody: cont,
+		}
+	}
+
+	if err := imageprompt.CheckStatus(resp, cont); err != nil {
+		return imageprompt.Response{}, err
 	}
 
 	if len(re.Choices) == 0 {
-		return "", errors.New("no choices found")
+		return imageprompt.Response{}, errors.New("no choices found")
 	}
 
-	return strings.Trim(re.Choices[0].Message.Content, `" \t`), nil
+	res := imageprompt.Response{
+		Usage: imageprompt.Usage{
+			InputTokens:  re.Usage.PromptTokens,
+			OutputTokens: re.Usage.CompletionTokens,
+		},
+	}
+
+	for i, c := range re.Choices {
+		a := imageprompt.Alternative{
+			Text:         strings.Trim(c.Message.Content, `" \t`),
+			FinishReason: c.FinishReason,
+		}
+
+		if c.Logprobs != nil && len(c.Logprobs.Content) > 0 {
+			sum := 0.0
+
+			for _, t := range c.Logprobs.Content {
+				sum += t.Logprob
+
+				if i == 0 && opts.Logprobs {
+					res.Logprobs = append(res.Logprobs, imageprompt.TokenLogprob{Token: t.Token, Logprob: t.Logprob})
+				}
+			}
+
+			a.Confidence = imageprompt.Confidence(sum / float64(len(c.Logprobs.Content)))
+		}
+
+		res.Alternatives = append(res.Alternatives, a)
+	}
+
+	res.Text = res.Alternatives[0].Text
+	res.Confidence = res.Alternatives[0].Confidence
+
+	return res, nil
 }
@@ -0,0 +1,150 @@
+// Package retry provides imageprompt.Prompter decorator that retries failed requests.
+package retry
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/vearutop/image-prompt/imageprompt"
+)
+
+// Policy defines retries.
+type Policy struct {
+	Attempts   int                  // Max number of attempts including the first one, default 3.
+	Backoff    time.Duration        // Delay before the first retry, default 1s.
+	MaxBackoff time.Duration        // Max delay between retries, default 30s.
+	Multiplier float64              // Delay growth factor, default 2.
+	Jitter     float64              // Fraction of delay to randomize, from 0 to 1.
+	Classify   func(err error) bool // Checks if error is retryable, default Retryable.
+}
+
+// Retryable checks if error is likely to be transient.
+//
+// Network errors, timeouts of a single attempt and HTTP statuses 408, 500, 502, 503, 504 are retryable.
+// Cancellation of the context and ErrResourceExhausted are not retryable.
+func Retryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, imageprompt.ErrResourceExhausted) {
+		return false
+	}
+
+	var ue imageprompt.ErrUnexpectedResponse
+	if errors.As(err, &ue) {
+		switch ue.StatusCode {
+		case http.StatusRequestTimeout, http.StatusInternalServerError, http.StatusBadGateway,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		default:
+			return false
+		}
+	}
+
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+
+	var ne net.Error
+
+	return errors.As(err, &ne)
+}
+
+// Prompter retries failed requests of upstream prompter with exponential backoff.
+type Prompter struct {
+	upstream imageprompt.Prompter
+	policy   Policy
+}
+
+var _ imageprompt.ResponsePrompter = &Prompter{}
+
+// New creates retrying prompter.
+func New(upstream imageprompt.Prompter, policy Policy) *Prompter {
+	if policy.Attempts <= 0 {
+		policy.Attempts = 3
+	}
+
+	if policy.Backoff <= 0 {
+		policy.Backoff = time.Second
+	}
+
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = 30 * time.Second
+	}
+
+	if policy.Multiplier < 1 {
+		policy.Multiplier = 2
+	}
+
+	if policy.Classify == nil {
+		policy.Classify = Retryable
+	}
+
+	return &Prompter{upstream: upstream, policy: policy}
+}
+
+// ModelName returns the name of upstream LLM.
+func (p *Prompter) ModelName() string {
+	return p.upstream.ModelName()
+}
+
+// PromptImage asks upstream LLM about JPEG image, retrying on failures.
+func (p *Prompter) PromptImage(ctx context.Context, prompt string, jpegImage io.Reader) (string, error) {
+	res, err := p.PromptImageResponse(ctx, prompt, jpegImage)
+
+	return res.Text, err
+}
+
+// PromptImageResponse asks upstream LLM about JPEG image, retrying on failures.
+//
+// Image is buffered to be replayed on retries.
+// Retries stop when the next delay does not fit in context deadline.
+func (p *Prompter) PromptImageResponse(ctx context.Context, prompt string, jpegImage io.Reader) (imageprompt.Response, error) {
+	img, err := io.ReadAll(jpegImage)
+	if err != nil {
+		return imageprompt.Response{}, err
+	}
+
+	delay := p.policy.Backoff
+
+	for attempt := 1; ; attempt++ {
+		res, err := imageprompt.PromptImageResponse(ctx, p.upstream, prompt, bytes.NewReader(img))
+		if err == nil || attempt >= p.policy.Attempts || !p.policy.Classify(err) {
+			return res, err
+		}
+
+		d := p.jittered(delay)
+
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < d {
+			return res, err
+		}
+
+		t := time.NewTimer(d)
+
+		select {
+		case <-ctx.Done():
+			t.Stop()
+
+			return res, err
+		case <-t.C:
+		}
+
+		delay = min(time.Duration(float64(delay)*p.policy.Multiplier), p.policy.MaxBackoff)
+	}
+}
+
+func (p *Prompter) jittered(d time.Duration) time.Duration {
+	if p.policy.Jitter <= 0 {
+		return d
+	}
+
+	j := min(p.policy.Jitter, 1)
+
+	// Random delay in [d*(1-j), d*(1+j)).
+	return time.Duration(float64(d) * (1 - j + 2*j*rand.Float64())) //nolint:gosec // Jitter does not need crypto rand.
+}
@@ -0,0 +1,194 @@
+package retry
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/vearutop/image-prompt/imageprompt"
+)
+
+// flakyPrompter fails with errs in order and then succeeds.
+type flakyPrompter struct {
+	errs   []error
+	calls  []time.Time
+	images [][]byte
+}
+
+func (f *flakyPrompter) PromptImage(_ context.Context, _ string, jpegImage io.Reader) (string, error) {
+	img, err := io.ReadAll(jpegImage)
+	if err != nil {
+		return "", err
+	}
+
+	f.images = append(f.images, img)
+	f.calls = append(f.calls, time.Now())
+
+	if i := len(f.calls) - 1; i < len(f.errs) {
+		return "", f.errs[i]
+	}
+
+	return "ok", nil
+}
+
+func (f *flakyPrompter) ModelName() string {
+	return "flaky"
+}
+
+func TestRetryable(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "canceled", err: fmt.Errorf("request: %w", context.Canceled), want: false},
+		{name: "deadline exceeded", err: context.DeadlineExceeded, want: true}, // It is a net.Error timeout.
+		{name: "exhausted", err: imageprompt.ErrResourceExhausted, want: false},
+		{name: "503", err: imageprompt.ErrUnexpectedResponse{StatusCode: http.StatusServiceUnavailable}, want: true},
+		{name: "504", err: imageprompt.ErrUnexpectedResponse{StatusCode: http.StatusGatewayTimeout}, want: true},
+		{name: "408", err: imageprompt.ErrUnexpectedResponse{StatusCode: http.StatusRequestTimeout}, want: true},
+		{name: "400", err: imageprompt.ErrUnexpectedResponse{StatusCode: http.StatusBadRequest}, want: false},
+		{name: "unexpected EOF", err: fmt.Errorf("read: %w", io.ErrUnexpectedEOF), want: true},
+		{name: "connection reset", err: &net.OpError{Op: "read", Err: syscall.ECONNRESET}, want: true},
+		{name: "connection refused", err: syscall.ECONNREFUSED, want: true},
+		{name: "dns", err: &net.DNSError{Err: "no such host"}, want: true},
+		{name: "other", err: errors.New("failed"), want: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Retryable(tc.err); got != tc.want {
+				t.Fatalf("%v expected, %v received", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestPrompter_PromptImageResponse(t *testing.T) {
+	transient := imageprompt.ErrUnexpectedResponse{StatusCode: http.StatusBadGateway}
+
+	for _, tc := range []struct {
+		name   string
+		policy Policy
+		errs   []error
+		calls  int
+		err    bool
+		gaps   []time.Duration // Expected min delays between attempts.
+	}{
+		{
+			name:   "success after retries",
+			policy: Policy{Attempts: 3, Backoff: time.Millisecond},
+			errs:   []error{transient, transient},
+			calls:  3,
+		},
+		{
+			name:   "attempts exhausted",
+			policy: Policy{Attempts: 2, Backoff: time.Millisecond},
+			errs:   []error{transient, transient, transient},
+			calls:  2,
+			err:    true,
+		},
+		{
+			name:   "not retryable",
+			policy: Policy{Attempts: 3, Backoff: time.Millisecond},
+			errs:   []error{imageprompt.ErrResourceExhausted},
+			calls:  1,
+			err:    true,
+		},
+		{
+			name: "custom classifier",
+			policy: Policy{Attempts: 3, Backoff: time.Millisecond, Classify: func(err error) bool {
+				return errors.Is(err, imageprompt.ErrResourceExhausted)
+			}},
+			errs:  []error{imageprompt.ErrResourceExhausted},
+			calls: 2,
+		},
+		{
+			name:   "backoff growth and cap",
+			policy: Policy{Attempts: 4, Backoff: 20 * time.Millisecond, Multiplier: 2, MaxBackoff: 30 * time.Millisecond},
+			errs:   []error{transient, transient, transient},
+			calls:  4,
+			gaps:   []time.Duration{20 * time.Millisecond, 30 * time.Millisecond, 30 * time.Millisecond},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := &flakyPrompter{errs: tc.errs}
+			img := []byte("jpeg image")
+
+			res, err := New(f, tc.policy).PromptImageResponse(context.Background(), "caption", bytes.NewReader(img))
+			if (err != nil) != tc.err {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !tc.err && res.Text != "ok" {
+				t.Fatalf("unexpected result %q", res.Text)
+			}
+
+			if len(f.calls) != tc.calls {
+				t.Fatalf("%d calls expected, %d received", tc.calls, len(f.calls))
+			}
+
+			// Image is replayed on each attempt.
+			for i, im := range f.images {
+				if !bytes.Equal(im, img) {
+					t.Fatalf("attempt %d: unexpected image %q", i+1, im)
+				}
+			}
+
+			for i, want := range tc.gaps {
+				gap := f.calls[i+1].Sub(f.calls[i])
+
+				// Upper bound is loose to tolerate slow test runners, but it detects missing cap (delay of 80ms).
+				if gap < want || gap > want+40*time.Millisecond {
+					t.Fatalf("gap %d: %v expected, %v received", i+1, want, gap)
+				}
+			}
+		})
+	}
+}
+
+func TestPrompter_PromptImageResponse_deadline(t *testing.T) {
+	f := &flakyPrompter{errs: []error{imageprompt.ErrUnexpectedResponse{StatusCode: http.StatusBadGateway}}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+
+	_, err := New(f, Policy{Attempts: 3, Backoff: time.Second}).PromptImageResponse(ctx, "caption", bytes.NewReader(nil))
+	if err == nil {
+		t.Fatal("error expected")
+	}
+
+	// Next delay does not fit in deadline, so there is no waiting.
+	if len(f.calls) != 1 || time.Since(start) > 50*time.Millisecond {
+		t.Fatalf("single attempt without waiting expected, %d calls in %v", len(f.calls), time.Since(start))
+	}
+}
+
+func TestPrompter_jittered(t *testing.T) {
+	for _, tc := range []struct {
+		jitter   float64
+		min, max time.Duration
+	}{
+		{jitter: 0, min: time.Second, max: time.Second},
+		{jitter: 0.2, min: 800 * time.Millisecond, max: 1200 * time.Millisecond},
+		{jitter: 2, min: 0, max: 2 * time.Second}, // Jitter is capped at 1.
+	} {
+		t.Run(fmt.Sprint(tc.jitter), func(t *testing.T) {
+			p := New(&flakyPrompter{}, Policy{Jitter: tc.jitter})
+
+			for range 1000 {
+				if d := p.jittered(time.Second); d < tc.min || d > tc.max {
+					t.Fatalf("delay %v out of [%v, %v]", d, tc.min, tc.max)
+				}
+			}
+		})
+	}
+}